@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The accounts file lists the snake games to watch. For example:
+//
+//	{
+//	  "accounts": [
+//	    {
+//	      "acct": "snake_game@botsin.space",
+//	      "aliases": ["snake_game"]
+//	    },
+//	    {
+//	      "acct": "snek@example.com",
+//	      "rules": {
+//	        "board_size": "10x10",
+//	        "option_words": {"hoch": "up", "weiter": "straight"},
+//	        "checkins": "50%,5m",
+//	        "palette": {"snake": "#E0A030", "food": "#C02020", "eyes": ["#000000"]}
+//	      }
+//	    }
+//	  ]
+//	}
+type AccountsFile struct {
+	Accounts []AccountConfig `json:"accounts"`
+}
+
+type AccountConfig struct {
+	// The account as it appears on our instance, plus any other ways it
+	// may be written, such as without the domain for a local account
+	Acct    string      `json:"acct"`
+	Aliases []string    `json:"aliases,omitempty"`
+	Rules   RulesConfig `json:"rules,omitempty"`
+}
+
+// How a snake game differs from snakebot's. Everything is optional.
+type RulesConfig struct {
+	// The board size to use when the alt text doesn't give one, e.g. "8x5"
+	BoardSize string `json:"board_size,omitempty"`
+
+	// Extra words, or whole option titles, and the move they stand for.
+	// Moves are directions, "straight", "turn left" or "turn right".
+	OptionWords map[string]string `json:"option_words,omitempty"`
+
+	// When to check the polls, as for run -checkins
+	CheckIns string `json:"checkins,omitempty"`
+
+	// The colours of the board, as #RRGGBB
+	Palette *PaletteConfig `json:"palette,omitempty"`
+}
+
+type PaletteConfig struct {
+	Snake string   `json:"snake,omitempty"`
+	Food  string   `json:"food,omitempty"`
+	Eyes  []string `json:"eyes,omitempty"`
+}
+
+// The rules for one account, ready to use
+type AccountRules struct {
+	BoardWidth  int
+	BoardHeight int
+	OptionWords map[string]string
+	CheckIns    []CheckIn
+	Palette     Palette
+}
+
+func defaultAccountRules() AccountRules {
+	return AccountRules{Palette: defaultPalette}
+}
+
+// An account the bot watches. The bot keeps each account's games apart.
+type WatchedAccount struct {
+	Acct    string
+	Aliases []string
+	Rules   AccountRules
+}
+
+// The account the bot watches if it isn't given an accounts file
+func defaultWatchedAccounts() []*WatchedAccount {
+	return []*WatchedAccount{{
+		Acct:    "snake_game@botsin.space",
+		Aliases: []string{"snake_game"},
+		Rules:   defaultAccountRules(),
+	}}
+}
+
+func (a *WatchedAccount) matches(acct string) bool {
+	if strings.EqualFold(acct, a.Acct) {
+		return true
+	}
+	for _, alias := range a.Aliases {
+		if strings.EqualFold(acct, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// The watched account a status comes from, if any
+func findWatchedAccount(accounts []*WatchedAccount, acct string) *WatchedAccount {
+	for _, account := range accounts {
+		if account.matches(acct) {
+			return account
+		}
+	}
+	return nil
+}
+
+func loadAccountsFile(filename string) ([]*WatchedAccount, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file AccountsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(file.Accounts) == 0 {
+		return nil, fmt.Errorf("%s: no accounts to watch", filename)
+	}
+
+	accounts := []*WatchedAccount{}
+	for _, config := range file.Accounts {
+		account, err := config.watchedAccount()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (c AccountConfig) watchedAccount() (*WatchedAccount, error) {
+	if c.Acct == "" {
+		return nil, errors.New("account without an acct")
+	}
+
+	rules, err := c.Rules.accountRules()
+	if err != nil {
+		return nil, fmt.Errorf("account %s: %v", c.Acct, err)
+	}
+
+	return &WatchedAccount{Acct: c.Acct, Aliases: c.Aliases, Rules: rules}, nil
+}
+
+func (c RulesConfig) accountRules() (AccountRules, error) {
+	rules := defaultAccountRules()
+	var err error
+
+	if c.BoardSize != "" {
+		rules.BoardWidth, rules.BoardHeight, err = extractBoardDimensions(c.BoardSize)
+		if err != nil {
+			return rules, fmt.Errorf("board_size: %v", err)
+		}
+	}
+
+	if len(c.OptionWords) > 0 {
+		rules.OptionWords = map[string]string{}
+		for word, move := range c.OptionWords {
+			if _, err := parsePollOption(move, "up", nil); err != nil {
+				return rules, fmt.Errorf("option_words: %q doesn't stand for a move", move)
+			}
+			rules.OptionWords[strings.ToLower(strings.TrimSpace(word))] = move
+		}
+	}
+
+	if c.CheckIns != "" {
+		rules.CheckIns, err = parseCheckIns(c.CheckIns)
+		if err != nil {
+			return rules, fmt.Errorf("checkins: %v", err)
+		}
+	}
+
+	if c.Palette != nil {
+		if c.Palette.Snake != "" {
+			if rules.Palette.Snake, err = parseHexColor(c.Palette.Snake); err != nil {
+				return rules, fmt.Errorf("palette: %v", err)
+			}
+		}
+		if c.Palette.Food != "" {
+			if rules.Palette.Food, err = parseHexColor(c.Palette.Food); err != nil {
+				return rules, fmt.Errorf("palette: %v", err)
+			}
+		}
+		if len(c.Palette.Eyes) > 0 {
+			rules.Palette.Eyes = nil
+			for _, hex := range c.Palette.Eyes {
+				eyeColor, err := parseHexColor(hex)
+				if err != nil {
+					return rules, fmt.Errorf("palette: %v", err)
+				}
+				rules.Palette.Eyes = append(rules.Palette.Eyes, eyeColor)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// The board size of an image, from its alt text or else the account's hint
+func (r AccountRules) boardDimensions(altText string) (int, int, error) {
+	width, height, err := extractBoardDimensions(altText)
+	if err != nil && r.BoardWidth > 0 {
+		return r.BoardWidth, r.BoardHeight, nil
+	}
+	return width, height, err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAccountsFile(t *testing.T, contents string) string {
+	filename := filepath.Join(t.TempDir(), "accounts.json")
+	if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write accounts file: %v", err)
+	}
+	return filename
+}
+
+func TestLoadAccountsFile(t *testing.T) {
+	// setup accounts file
+	filename := writeAccountsFile(t, `{
+		"accounts": [
+			{"acct": "snake_game@botsin.space", "aliases": ["snake_game"]},
+			{
+				"acct": "snek@example.com",
+				"rules": {
+					"board_size": "10x6",
+					"option_words": {"Hoch": "up"},
+					"checkins": "50%,5m",
+					"palette": {"snake": "#E0A030", "eyes": ["#000000"]}
+				}
+			}
+		]
+	}`)
+
+	// call function to test
+	accounts, err := loadAccountsFile(filename)
+
+	// check result
+	if err != nil {
+		t.Fatalf("loadAccountsFile returned error %v", err)
+	}
+	if findWatchedAccount(accounts, "snake_game") != accounts[0] || findWatchedAccount(accounts, "Snek@example.com") != accounts[1] {
+		t.Errorf("findWatchedAccount didn't find the accounts by acct and alias")
+	}
+	if findWatchedAccount(accounts, "someone") != nil {
+		t.Errorf("findWatchedAccount found an account which isn't watched")
+	}
+
+	rules := accounts[1].Rules
+	if rules.BoardWidth != 10 || rules.BoardHeight != 6 {
+		t.Errorf("board size was %dx%d, want 10x6", rules.BoardWidth, rules.BoardHeight)
+	}
+	if rules.OptionWords["hoch"] != "up" {
+		t.Errorf("option words were %v, want hoch for up", rules.OptionWords)
+	}
+	if checkInsString(rules.CheckIns) != "50%,5m0s" {
+		t.Errorf("check-ins were %s, want 50%%,5m0s", checkInsString(rules.CheckIns))
+	}
+	if rules.Palette.Snake != (color{0xE0, 0xA0, 0x30}) || rules.Palette.Food != foodColor || len(rules.Palette.Eyes) != 1 {
+		t.Errorf("palette was %v, want a custom snake colour and eyes with the default food colour", rules.Palette)
+	}
+
+	width, height, err := rules.boardDimensions("A snake game")
+	if err != nil || width != 10 || height != 6 {
+		t.Errorf("boardDimensions returned %d, %d, %v, want the 10x6 hint", width, height, err)
+	}
+	width, height, _ = rules.boardDimensions("A 12x7 board")
+	if width != 12 || height != 7 {
+		t.Errorf("boardDimensions returned %dx%d, want 12x7 from the alt text", width, height)
+	}
+}
+
+func TestLoadAccountsFileRejectsBadRules(t *testing.T) {
+	invalid := []string{
+		`{"accounts": []}`,
+		`{"accounts": [{"aliases": ["snake_game"]}]}`,
+		`{"accounts": [{"acct": "a", "rules": {"board_size": "big"}}]}`,
+		`{"accounts": [{"acct": "a", "rules": {"option_words": {"hoch": "sideways"}}}]}`,
+		`{"accounts": [{"acct": "a", "rules": {"checkins": "soon"}}]}`,
+		`{"accounts": [{"acct": "a", "rules": {"palette": {"snake": "blue"}}}]}`,
+	}
+	for _, contents := range invalid {
+		if _, err := loadAccountsFile(writeAccountsFile(t, contents)); err == nil {
+			t.Errorf("loadAccountsFile(%s) returned no error", contents)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// What admins can change while the bot runs. The stream loop changes it
+// and the poll worker reads it, so it's guarded by a mutex.
+type BotControls struct {
+	mutex        sync.Mutex
+	votingPaused bool
+	policy       VotePolicy
+	dryRun       bool
+}
+
+func newBotControls(policy VotePolicy) *BotControls {
+	return &BotControls{policy: policy}
+}
+
+func (c *BotControls) pauseVoting(paused bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.votingPaused = paused
+}
+
+func (c *BotControls) isVotingPaused() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.votingPaused
+}
+
+func (c *BotControls) setPolicy(policy VotePolicy) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.policy = policy
+}
+
+func (c *BotControls) currentPolicy() VotePolicy {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.policy
+}
+
+func (c *BotControls) setDryRun(dryRun bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.dryRun = dryRun
+}
+
+func (c *BotControls) isDryRun() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.dryRun
+}
+
+// Stands in for the services which change anything on the fediverse. While
+// a dry run is on, posts, edits, uploads and votes are only logged, much as
+// in shadow mode; otherwise they go through as usual.
+type DryRunServices struct {
+	controls  *BotControls
+	publisher Publisher
+	editor    Editor
+	media     MediaUploader
+	voter     Voter
+	clock     Clock
+
+	mutex  sync.Mutex
+	lastID int
+}
+
+// Route a bot's posting, editing, uploading and voting through the dry run
+// switch
+func withDryRun(services BotServices, controls *BotControls) BotServices {
+	dryRun := &DryRunServices{controls: controls, publisher: services.Publisher, editor: services.Editor, media: services.Media, voter: services.Voter, clock: services.Clock}
+	services.Publisher = dryRun
+	if services.Editor != nil {
+		services.Editor = dryRun
+	}
+	if services.Media != nil {
+		services.Media = dryRun
+	}
+	services.Voter = dryRun
+	return services
+}
+
+// A made up ID for something the dry run didn't do
+func (d *DryRunServices) newID() mastodon.ID {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.lastID++
+	return mastodon.ID(fmt.Sprintf("dry-run-%d", d.lastID))
+}
+
+func (d *DryRunServices) PostStatus(ctx context.Context, toot *mastodon.Toot) (*mastodon.Status, error) {
+	if !d.controls.isDryRun() {
+		return d.publisher.PostStatus(ctx, toot)
+	}
+	fmt.Printf("🔧 Dry run: not posting %q\n", toot.Status)
+	return &mastodon.Status{ID: d.newID(), Content: toot.Status, CreatedAt: d.clock.Now()}, nil
+}
+
+func (d *DryRunServices) EditStatus(ctx context.Context, id mastodon.ID, toot *mastodon.Toot) (*mastodon.Status, error) {
+	if !d.controls.isDryRun() {
+		return d.editor.EditStatus(ctx, id, toot)
+	}
+	fmt.Printf("🔧 Dry run: not editing %s to %q\n", id, toot.Status)
+	return &mastodon.Status{ID: id, Content: toot.Status}, nil
+}
+
+func (d *DryRunServices) UploadMediaFromMedia(ctx context.Context, media *mastodon.Media) (*mastodon.Attachment, error) {
+	if !d.controls.isDryRun() {
+		return d.media.UploadMediaFromMedia(ctx, media)
+	}
+	fmt.Println("🔧 Dry run: not uploading an image")
+	return &mastodon.Attachment{ID: d.newID(), Type: "image", Description: media.Description}, nil
+}
+
+func (d *DryRunServices) Vote(ctx context.Context, id mastodon.ID, move string, choices ...int) (*mastodon.Poll, error) {
+	if !d.controls.isDryRun() {
+		return d.voter.Vote(ctx, id, move, choices...)
+	}
+	fmt.Println("🔧 Dry run: not voting for", choices, move, "on poll", id)
+	// The poll hasn't been voted on, so that the worker can still vote on it
+	// once the dry run is over
+	return &mastodon.Poll{ID: id}, nil
+}
+
+// One line of the audit log: a command from an admin and what came of it
+type AuditRecord struct {
+	Time     time.Time   `json:"time"`
+	Admin    string      `json:"admin"`
+	StatusID mastodon.ID `json:"status_id"`
+	Command  string      `json:"command"`
+	OK       bool        `json:"ok"`
+	Result   string      `json:"result"`
+}
+
+// Appends admin commands to a JSON lines file
+type AuditLog struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func openAuditLog(filename string) (*AuditLog, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file}, nil
+}
+
+func (a *AuditLog) write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+// How long the status command waits for the poll worker
+const stateQueryTimeout = 5 * time.Second
+
+const adminHelp = "Commands: pause voting, resume, strategy <policy>, status, dry-run on, dry-run off, reanalyse <status URL>"
+
+// Runs commands which admins send the bot as direct messages
+type AdminConsole struct {
+	admins      []string
+	controls    *BotControls
+	audit       *AuditLog
+	publisher   Publisher
+	composer    *Composer
+	clock       Clock
+	scheduler   *PollScheduler
+	pollChannel chan PollMessage
+
+	// How long to wait for the poll worker's state. The default is
+	// stateQueryTimeout.
+	queryTimeout time.Duration
+
+	// Analyse a board again, by the URL of its status
+	reanalyse func(statusURL string) (string, error)
+}
+
+// Whether an account is one of the admins. Admins are written as our
+// instance shows them, so accounts on our own instance have no domain.
+func (a *AdminConsole) isAdmin(acct string) bool {
+	for _, admin := range a.admins {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(admin), "@"), acct) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run the command in a direct message from an admin, acknowledge it and
+// audit it. Returns false if the mention isn't a direct message from an
+// admin, so that it can be handled as anything else.
+func (a *AdminConsole) handle(mention *mastodon.Status) bool {
+	if a == nil || mention.Visibility != "direct" || !a.isAdmin(mention.Account.Acct) {
+		return false
+	}
+	admin := mention.Account.Acct
+	command := adminCommandText(mention.Content)
+	fmt.Println("🔧 Command from", admin+":", command)
+
+	result, err := a.run(command)
+	ok := err == nil
+	if err != nil {
+		result = err.Error()
+	}
+	fmt.Println("🔧", result)
+
+	if a.audit != nil {
+		record := AuditRecord{Time: a.clock.Now(), Admin: admin, StatusID: mention.ID, Command: command, OK: ok, Result: result}
+		if err := a.audit.write(record); err != nil {
+			fmt.Println("🔧 Failed to write to the audit log:", err)
+		}
+	}
+
+	reply := "@" + admin + " " + result
+	if a.composer != nil && a.composer.MaxCharacters > 0 && statusLength(reply) > a.composer.MaxCharacters {
+		reply = truncateStatus(reply, a.composer.MaxCharacters)
+	}
+	toot := &mastodon.Toot{Status: reply, InReplyToID: mention.ID, Visibility: "direct"}
+	if _, err := makePost(a.publisher, toot); err != nil {
+		fmt.Println("🔧 Failed to acknowledge the command:", err)
+	}
+	return true
+}
+
+// The command in a direct message: its text without the mentions of the bot
+func adminCommandText(content string) string {
+	words := strings.Fields(statusText(content))
+	for len(words) > 0 && strings.HasPrefix(words[0], "@") {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// Run a command, returning what to tell the admin
+func (a *AdminConsole) run(command string) (string, error) {
+	name, argument, _ := strings.Cut(command, " ")
+	argument = strings.TrimSpace(argument)
+
+	switch strings.ToLower(name) {
+	case "pause":
+		if argument != "" && !strings.EqualFold(argument, "voting") {
+			return "", fmt.Errorf("I can only pause voting. %s", adminHelp)
+		}
+		a.controls.pauseVoting(true)
+		return "Voting paused. I'll keep analysing boards but won't vote until you say resume.", nil
+	case "resume":
+		a.controls.pauseVoting(false)
+		return "Voting resumed.", nil
+	case "strategy":
+		if argument == "" {
+			return "", fmt.Errorf("strategy needs a policy: %s, or a rule", policyNames())
+		}
+		policy, err := parseVotePolicy(argument)
+		if err != nil {
+			return "", err
+		}
+		a.controls.setPolicy(policy)
+		return fmt.Sprintf("Voting with the policy %s from now on.", policy), nil
+	case "status":
+		return a.status(), nil
+	case "dry-run":
+		switch strings.ToLower(argument) {
+		case "on":
+			a.controls.setDryRun(true)
+			return "Dry run on: I won't post or vote, only log what I would have done. I'll still answer you.", nil
+		case "off":
+			a.controls.setDryRun(false)
+			return "Dry run off: posting and voting for real again.", nil
+		}
+		return "", errors.New("dry-run needs on or off")
+	case "reanalyse", "reanalyze":
+		if argument == "" {
+			return "", errors.New("reanalyse needs the URL of a board")
+		}
+		return a.reanalyse(argument)
+	case "help":
+		return adminHelp, nil
+	}
+	return "", fmt.Errorf("unknown command %q. %s", command, adminHelp)
+}
+
+// What the bot is doing: its controls, the games the poll worker is
+// following and the checks waiting for their timers
+func (a *AdminConsole) status() string {
+	voting := "on"
+	if a.controls.isVotingPaused() {
+		voting = "paused"
+	}
+	dryRun := "off"
+	if a.controls.isDryRun() {
+		dryRun = "on"
+	}
+	lines := []string{fmt.Sprintf("Voting %s, policy %s, dry run %s.", voting, a.controls.currentPolicy(), dryRun)}
+
+	// The worker may be busy voting, so don't wait for it for long. The
+	// reply has room for the answer so that a late one doesn't block it.
+	reply := make(chan []GameRecord, 1)
+	queryTimeout := a.queryTimeout
+	if queryTimeout <= 0 {
+		queryTimeout = stateQueryTimeout
+	}
+	timeout := time.After(queryTimeout)
+	var games []GameRecord
+	select {
+	case a.pollChannel <- PollMessage{MessageType: StateQuery, StateReply: reply}:
+		select {
+		case games = <-reply:
+		case <-timeout:
+		}
+	case <-timeout:
+	}
+	if games == nil {
+		lines = append(lines, "The poll worker is busy, so I can't list the games in progress.")
+	} else if len(games) == 0 {
+		lines = append(lines, "No games in progress.")
+	}
+	for _, game := range games {
+		acct := "?"
+		if game.Account != nil {
+			acct = game.Account.Acct
+		}
+		lines = append(lines, fmt.Sprintf("%s board %s: %s.", acct, game.UpdateID, game.stage()))
+	}
+
+	checks := a.scheduler.pendingChecks()
+	if len(checks) == 0 {
+		lines = append(lines, "No checks pending.")
+	}
+	now := a.clock.Now()
+	for _, check := range checks {
+		lines = append(lines, fmt.Sprintf("Checking poll %s in %v, %.0f%% of the way through.", check.PollID, check.FireAt.Sub(now).Round(time.Second), check.Elapsed*100))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Look up a board by the URL of its status. It has to be from one of the
+// snake games the bot watches.
+func findBoardStatus(ctx context.Context, searcher StatusSearcher, accounts []*WatchedAccount, statusURL string) (*mastodon.Status, *WatchedAccount, error) {
+	if searcher == nil {
+		return nil, nil, errors.New("I can't look statuses up")
+	}
+	results, err := searcher.Search(ctx, statusURL, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't look up %s: %v", statusURL, err)
+	}
+
+	var board *mastodon.Status
+	for _, status := range results.Statuses {
+		if status.URL == statusURL || status.URI == statusURL {
+			board = status
+		}
+	}
+	if board == nil {
+		return nil, nil, fmt.Errorf("couldn't find a status at %s", statusURL)
+	}
+
+	account := findWatchedAccount(accounts, board.Account.Acct)
+	if account == nil {
+		return nil, nil, fmt.Errorf("%s isn't from a snake game I watch", statusURL)
+	}
+	if len(board.MediaAttachments) == 0 || board.MediaAttachments[0].Type != "image" {
+		return nil, nil, fmt.Errorf("%s has no board", statusURL)
+	}
+	return board, account, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestAdminCommandText(t *testing.T) {
+	// setup
+	content := `<p><span class="h-card"><a href="https://example.com/@snakebot_admirer" class="u-url mention">@<span>snakebot_admirer</span></a></span>  strategy   never</p>`
+
+	// call function to test
+	got := adminCommandText(content)
+
+	// check result
+	if got != "strategy never" {
+		t.Errorf("adminCommandText returned %q, want %q", got, "strategy never")
+	}
+}
+
+func TestAdminConsoleIsAdmin(t *testing.T) {
+	// setup
+	console := &AdminConsole{admins: []string{"@Alice@example.com", " bob "}}
+	tests := []struct {
+		acct string
+		want bool
+	}{
+		{"alice@example.com", true},
+		{"alice", false},
+		{"alice@elsewhere.example", false},
+		{"bob", true},
+		{"bob@example.com", false},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got := console.isAdmin(test.acct)
+
+		// check result
+		if got != test.want {
+			t.Errorf("isAdmin(%q) returned %v, want %v", test.acct, got, test.want)
+		}
+	}
+}
+
+func TestAdminConsoleRun(t *testing.T) {
+	// setup
+	controls := newBotControls(VotePolicy{})
+	console := &AdminConsole{controls: controls}
+
+	steps := []struct {
+		command string
+		wantErr string
+		check   func() bool
+	}{
+		{"pause voting", "", controls.isVotingPaused},
+		{"Resume", "", func() bool { return !controls.isVotingPaused() }},
+		{"pause everything", "only pause voting", nil},
+		{"dry-run on", "", controls.isDryRun},
+		{"dry-run maybe", "needs on or off", controls.isDryRun},
+		{"DRY-RUN OFF", "", func() bool { return !controls.isDryRun() }},
+		{"strategy always", "", func() bool { return controls.currentPolicy().String() == "always" }},
+		{"strategy", "needs a policy", func() bool { return controls.currentPolicy().String() == "always" }},
+		{"reanalyse", "needs the URL", nil},
+		{"vote up", "unknown command", nil},
+	}
+
+	for _, step := range steps {
+		// call function to test
+		_, err := console.run(step.command)
+
+		// check result
+		if step.wantErr == "" && err != nil {
+			t.Errorf("run(%q) returned error %v", step.command, err)
+		}
+		if step.wantErr != "" && (err == nil || !strings.Contains(err.Error(), step.wantErr)) {
+			t.Errorf("run(%q) returned error %v, want one saying %q", step.command, err, step.wantErr)
+		}
+		if step.check != nil && !step.check() {
+			t.Errorf("run(%q) didn't change the controls as expected", step.command)
+		}
+	}
+}
+
+func TestDryRunServices(t *testing.T) {
+	// setup
+	controls := newBotControls(VotePolicy{})
+	publisher := &recordingPublisher{}
+	services := withDryRun(BotServices{Publisher: publisher, Clock: newFakeClock(schedulerStart)}, controls)
+	toot := &mastodon.Toot{Status: "move up"}
+
+	// call function to test
+	controls.setDryRun(true)
+	skipped, err := services.Publisher.PostStatus(context.Background(), toot)
+	controls.setDryRun(false)
+	posted, _ := services.Publisher.PostStatus(context.Background(), toot)
+
+	// check result
+	if err != nil || !strings.HasPrefix(string(skipped.ID), "dry-run-") {
+		t.Errorf("PostStatus during a dry run returned %v, %v, want a made up status", skipped, err)
+	}
+	if posted.ID != "posted" || len(publisher.toots) != 1 {
+		t.Errorf("PostStatus after the dry run posted %d statuses, want 1", len(publisher.toots))
+	}
+}
+
+func TestAdminStatusDoesntWaitForABusyWorker(t *testing.T) {
+	// setup: a worker which never answers
+	clock := newFakeClock(schedulerStart)
+	console := &AdminConsole{
+		controls:     newBotControls(VotePolicy{}),
+		clock:        clock,
+		scheduler:    newPollScheduler(clock),
+		pollChannel:  make(chan PollMessage),
+		queryTimeout: 10 * time.Millisecond,
+	}
+
+	// call function to test
+	done := make(chan string)
+	go func() { done <- console.status() }()
+
+	// check result
+	select {
+	case status := <-done:
+		if !strings.Contains(status, "busy") {
+			t.Errorf("status returned %q, want it to say the worker is busy", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("status kept waiting for the poll worker")
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// By default subscribers hear about a snake in danger when its poll has ten
+// minutes left, and get at most one alert an hour
+const (
+	defaultAlertLead     = 10 * time.Minute
+	defaultAlertInterval = time.Hour
+)
+
+// How many subscribe and unsubscribe commands one account can send in each
+// window. Each is answered by direct message, so this keeps anyone from
+// using the bot to send a flood of them.
+const (
+	subscriptionLimit  = 5
+	subscriptionWindow = time.Hour
+)
+
+// How the bot warns its subscribers when the snake is about to die
+type AlertConfig struct {
+	// Who to warn. Alerts are off without it.
+	Subscribers *SubscriberStore
+
+	// How long before a poll closes to look for danger, and how long each
+	// subscriber goes between alerts. The defaults are defaultAlertLead and
+	// defaultAlertInterval.
+	Lead     time.Duration
+	Interval time.Duration
+}
+
+func (c AlertConfig) lead() time.Duration {
+	if c.Lead <= 0 {
+		return defaultAlertLead
+	}
+	return c.Lead
+}
+
+func (c AlertConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultAlertInterval
+	}
+	return c.Interval
+}
+
+// Someone who asked to be told when the snake is in danger
+type Subscriber struct {
+	Acct      string    `json:"acct"`
+	Since     time.Time `json:"since"`
+	LastAlert time.Time `json:"last_alert"`
+}
+
+// The subscribers, kept in a JSON file so that they outlast restarts. The
+// stream loop adds and removes them and the alert worker alerts them, so
+// it's guarded by a mutex.
+type SubscriberStore struct {
+	mutex       sync.Mutex
+	filename    string
+	subscribers []*Subscriber
+}
+
+// Open the subscribers file, which doesn't have to exist yet
+func openSubscriberStore(filename string) (*SubscriberStore, error) {
+	store := &SubscriberStore{filename: filename}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.subscribers); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return store, nil
+}
+
+// Write the subscribers out, replacing the file in one go so that a crash
+// can't leave half of it behind. The caller holds the mutex.
+func (s *SubscriberStore) save() error {
+	data, err := json.MarshalIndent(s.subscribers, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := s.filename + ".tmp"
+	if err := os.WriteFile(temporary, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, s.filename)
+}
+
+// The subscriber with an account, if there is one. The caller holds the
+// mutex.
+func (s *SubscriberStore) find(acct string) int {
+	for idx, subscriber := range s.subscribers {
+		if strings.EqualFold(subscriber.Acct, acct) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Add a subscriber. Returns false if they were already subscribed.
+func (s *SubscriberStore) subscribe(acct string, now time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.find(acct) >= 0 {
+		return false, nil
+	}
+	s.subscribers = append(s.subscribers, &Subscriber{Acct: acct, Since: now})
+	return true, s.save()
+}
+
+// Remove a subscriber. Returns false if they weren't subscribed.
+func (s *SubscriberStore) unsubscribe(acct string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	idx := s.find(acct)
+	if idx < 0 {
+		return false, nil
+	}
+	s.subscribers = append(s.subscribers[:idx], s.subscribers[idx+1:]...)
+	return true, s.save()
+}
+
+// The subscribers who haven't had an alert in the last interval, oldest
+// subscribers first
+func (s *SubscriberStore) due(now time.Time, interval time.Duration) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	due := []string{}
+	for _, subscriber := range s.subscribers {
+		if now.Sub(subscriber.LastAlert) >= interval {
+			due = append(due, subscriber.Acct)
+		}
+	}
+	return due
+}
+
+// Record the alerts which went out, so that the subscribers don't get
+// another one until the interval has passed
+func (s *SubscriberStore) alerted(accts []string, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, acct := range accts {
+		if idx := s.find(acct); idx >= 0 {
+			s.subscribers[idx].LastAlert = now
+		}
+	}
+	if len(accts) == 0 {
+		return nil
+	}
+	return s.save()
+}
+
+// The subscription command in a mention, if it's one: subscribe or
+// unsubscribe on its own
+func subscriptionCommand(content string) (string, bool) {
+	command := strings.ToLower(strings.TrimRight(adminCommandText(content), ".!"))
+	switch command {
+	case "subscribe", "unsubscribe":
+		return command, true
+	}
+	return "", false
+}
+
+// Subscribe or unsubscribe someone who asked, and tell them so by direct
+// message. Commands over the account's limit are ignored. Returns false if
+// the mention isn't a subscription command, so that it can be handled as
+// anything else.
+func handleSubscription(services BotServices, config BotConfig, limiter *AccountLimiter, mention *mastodon.Status) bool {
+	store := config.Alerts.Subscribers
+	if store == nil {
+		return false
+	}
+	command, ok := subscriptionCommand(mention.Content)
+	if !ok {
+		return false
+	}
+	acct := mention.Account.Acct
+	if !limiter.allow(acct) {
+		fmt.Println("🚨", acct, "has sent", limiter.limit, "subscription commands in the last", limiter.window, "so ignoring this one")
+		return true
+	}
+
+	var reply string
+	if command == "subscribe" {
+		added, err := store.subscribe(acct, services.Clock.Now())
+		switch {
+		case err != nil:
+			fmt.Println("🚨 Failed to save the subscribers:", err)
+			reply = "Sorry, something went wrong and I couldn't subscribe you. Please try again later."
+		case added:
+			fmt.Println("🚨", acct, "subscribed to alerts")
+			reply = fmt.Sprintf("You're subscribed. I'll send you a direct message when the snake is about to die and its poll has %s left, at most once every %s. Send unsubscribe to stop.", durationText(config.Alerts.lead()), durationText(config.Alerts.interval()))
+		default:
+			reply = "You're already subscribed. Send unsubscribe to stop."
+		}
+	} else {
+		removed, err := store.unsubscribe(acct)
+		switch {
+		case err != nil:
+			fmt.Println("🚨 Failed to save the subscribers:", err)
+			reply = "Sorry, something went wrong and I couldn't unsubscribe you. Please try again later."
+		case removed:
+			fmt.Println("🚨", acct, "unsubscribed from alerts")
+			reply = "You're unsubscribed. You won't get any more alerts."
+		default:
+			reply = "You weren't subscribed. Send subscribe to get alerts."
+		}
+	}
+
+	toot := &mastodon.Toot{Status: "@" + acct + " " + reply, InReplyToID: mention.ID, Visibility: "direct"}
+	if _, err := makePost(services.Publisher, toot); err != nil {
+		fmt.Println("🚨 Failed to answer", acct+":", err)
+	}
+	return true
+}
+
+// What's at stake on a poll: why the snake looks like dying. Nothing if it
+// doesn't.
+func alertReasons(vc VoteContext) []string {
+	reasons := []string{}
+	if vc.MustTurn {
+		reasons = append(reasons, "it crashes if it keeps going "+vc.Game.Direction)
+	}
+	leader, votes := vc.leadingMove()
+	if evaluation, ok := vc.evaluation(leader); ok && evaluation.Deadly && votes > 0 {
+		reasons = append(reasons, fmt.Sprintf("the winning move %s looks deadly", leader))
+	}
+	return reasons
+}
+
+// The direct message warning a subscriber
+func alertText(acct string, reasons []string, timeLeft time.Duration, pollURL string) string {
+	text := fmt.Sprintf("@%s The snake is in danger: %s. The poll closes in %s", acct, strings.Join(reasons, " and "), durationText(timeLeft))
+	if pollURL != "" {
+		text += ", vote at " + pollURL
+	}
+	return text + ". Send unsubscribe to stop these alerts."
+}
+
+// A duration for people, to the minute
+func durationText(d time.Duration) string {
+	d = d.Round(time.Minute)
+	switch {
+	case d < time.Minute:
+		return "less than a minute"
+	case d == time.Minute:
+		return "a minute"
+	case d == time.Hour:
+		return "an hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+	return fmt.Sprintf("%d minutes", d/time.Minute)
+}
+
+// How many alert checks can wait for the alert worker. Checks which come in
+// while the queue is full are dropped.
+const alertQueueSize = 10
+
+// A poll to look at for danger: a copy of the poll worker's record of the
+// game, and the clock of the poll's instance
+type AlertRequest struct {
+	Record      GameRecord
+	ServerClock *ServerClock
+}
+
+// Queue an alert check for the alert worker, dropping it if the queue is full
+func queueAlert(queue chan<- AlertRequest, request AlertRequest) {
+	select {
+	case queue <- request:
+	default:
+		fmt.Println("🚨 Too many alert checks waiting, so skipping poll", request.Record.PollID)
+	}
+}
+
+// Look at queued polls one at a time, apart from the poll worker, so that
+// sending alerts doesn't hold up votes. Runs until the context is cancelled.
+func processAlerts(ctx context.Context, queue <-chan AlertRequest, services BotServices, config BotConfig) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case request := <-queue:
+			alertSubscribers(ctx, services, config, request)
+		}
+	}
+}
+
+// Look at a poll shortly before it closes and warn the subscribers if the
+// snake looks like dying. Each subscriber gets at most one alert in each
+// interval, however many polls are in danger.
+func alertSubscribers(ctx context.Context, services BotServices, config BotConfig, request AlertRequest) {
+	record := request.Record
+	now := services.Clock.Now()
+	poll, err := services.Polls.GetPoll(ctx, record.PollID)
+	if err != nil {
+		fmt.Println("🚨 Error getting poll:", err)
+		return
+	}
+	if poll.Expired {
+		fmt.Println("🚨 Poll", record.PollID, "has closed, so it's too late to alert anyone")
+		return
+	}
+
+	reasons := alertReasons(VoteContext{
+		Now:      now,
+		Poll:     poll,
+		Options:  record.Options,
+		Game:     record.GameState,
+		Moves:    record.Moves,
+		BestMove: record.MyVote,
+		MustTurn: record.MustTurn,
+	})
+	if len(reasons) == 0 {
+		fmt.Println("🚨 The snake looks safe on poll", record.PollID)
+		return
+	}
+
+	due := config.Alerts.Subscribers.due(now, config.Alerts.interval())
+	fmt.Println("🚨 The snake is in danger on poll", record.PollID, "so alerting", len(due), "subscribers")
+
+	// The poll closes by its instance's clock, which may be off from ours
+	serverNow := now
+	if request.ServerClock != nil {
+		serverNow = request.ServerClock.now()
+	}
+	timeLeft := poll.ExpiresAt.Sub(serverNow)
+
+	// Only the alerts which went out count towards the interval, so that
+	// anyone who missed one gets the next
+	alerted := []string{}
+	for _, acct := range due {
+		text := alertText(acct, reasons, timeLeft, record.PollURL)
+		if config.Composer != nil && config.Composer.MaxCharacters > 0 && statusLength(text) > config.Composer.MaxCharacters {
+			text = truncateStatus(text, config.Composer.MaxCharacters)
+		}
+		if _, err := makePost(services.Publisher, &mastodon.Toot{Status: text, Visibility: "direct"}); err != nil {
+			fmt.Println("🚨 Failed to alert", acct+":", err)
+			continue
+		}
+		alerted = append(alerted, acct)
+	}
+	if err := config.Alerts.Subscribers.alerted(alerted, now); err != nil {
+		fmt.Println("🚨 Failed to save the subscribers:", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestSubscriberStore(t *testing.T) {
+	// setup
+	filename := filepath.Join(t.TempDir(), "subscribers.json")
+	store, err := openSubscriberStore(filename)
+	if err != nil {
+		t.Fatalf("openSubscriberStore returned error %v", err)
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// call function to test
+	for _, acct := range []string{"alice", "bob@example.com", "Alice"} {
+		if _, err := store.subscribe(acct, start); err != nil {
+			t.Fatalf("subscribe(%q) returned error %v", acct, err)
+		}
+	}
+	first := store.due(start, time.Hour)
+	if err := store.alerted(first, start); err != nil {
+		t.Fatalf("alerted returned error %v", err)
+	}
+	tooSoon := store.due(start.Add(59*time.Minute), time.Hour)
+	removed, _ := store.unsubscribe("ALICE")
+	notSubscribed, _ := store.unsubscribe("carol")
+
+	// check result
+	if want := []string{"alice", "bob@example.com"}; !reflect.DeepEqual(first, want) {
+		t.Errorf("due returned %v, want %v", first, want)
+	}
+	if len(tooSoon) != 0 {
+		t.Errorf("due within the interval returned %v, want nobody", tooSoon)
+	}
+	if !removed || notSubscribed {
+		t.Errorf("unsubscribe returned %v for a subscriber and %v for a stranger, want true and false", removed, notSubscribed)
+	}
+
+	// The subscribers and their last alerts outlast a restart
+	reopened, err := openSubscriberStore(filename)
+	if err != nil {
+		t.Fatalf("openSubscriberStore returned error %v", err)
+	}
+	if due := reopened.due(start.Add(30*time.Minute), time.Hour); len(due) != 0 {
+		t.Errorf("due after reopening returned %v, want nobody", due)
+	}
+	if due := reopened.due(start.Add(time.Hour), time.Hour); !reflect.DeepEqual(due, []string{"bob@example.com"}) {
+		t.Errorf("due after reopening returned %v, want [bob@example.com]", due)
+	}
+}
+
+func TestSubscriptionCommand(t *testing.T) {
+	// setup
+	tests := []struct {
+		content string
+		want    string
+		ok      bool
+	}{
+		{`<p><span class="h-card"><a href="https://example.com/@snakebot_admirer" class="u-url mention">@<span>snakebot_admirer</span></a></span> subscribe</p>`, "subscribe", true},
+		{"@snakebot_admirer Unsubscribe!", "unsubscribe", true},
+		{"@snakebot_admirer please subscribe me", "", false},
+		{"@snakebot_admirer v1/8x5/H3l2d/H1/r", "", false},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got, ok := subscriptionCommand(test.content)
+
+		// check result
+		if got != test.want || ok != test.ok {
+			t.Errorf("subscriptionCommand(%q) returned %q, %v, want %q, %v", test.content, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestAlertReasons(t *testing.T) {
+	// setup
+	moves := []MoveEvaluation{{Move: "up", Score: 10}, {Move: "down", Deadly: true}, {Move: "right", Deadly: true}}
+	options := map[string]int{"up": 0, "down": 1, "right": 2}
+	poll := func(votes ...int64) *mastodon.Poll {
+		poll := &mastodon.Poll{}
+		for _, count := range votes {
+			poll.Options = append(poll.Options, mastodon.PollOption{VotesCount: count})
+			poll.VotesCount += count
+		}
+		return poll
+	}
+	tests := []struct {
+		name     string
+		context  VoteContext
+		wantText []string
+	}{
+		{"doomed and nobody voted", VoteContext{Poll: poll(0, 0, 0), MustTurn: true}, []string{"it crashes if it keeps going right"}},
+		{"safe leader", VoteContext{Poll: poll(3, 1, 0)}, []string{}},
+		{"deadly leader", VoteContext{Poll: poll(1, 4, 0)}, []string{"the winning move down looks deadly"}},
+		{"doomed with a deadly leader", VoteContext{Poll: poll(0, 0, 2), MustTurn: true}, []string{"it crashes if it keeps going right", "the winning move right looks deadly"}},
+	}
+
+	for _, test := range tests {
+		test.context.Game = doomedGame
+		test.context.Moves = moves
+		test.context.Options = options
+
+		// call function to test
+		got := alertReasons(test.context)
+
+		// check result
+		if !reflect.DeepEqual(got, test.wantText) {
+			t.Errorf("%s: alertReasons returned %q, want %q", test.name, got, test.wantText)
+		}
+	}
+}
+
+func TestDurationText(t *testing.T) {
+	// setup
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{20 * time.Second, "less than a minute"},
+		{50 * time.Second, "a minute"},
+		{10*time.Minute + 5*time.Second, "10 minutes"},
+		{time.Hour, "an hour"},
+		{90 * time.Minute, "90 minutes"},
+		{3 * time.Hour, "3 hours"},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got := durationText(test.duration)
+
+		// check result
+		if got != test.want {
+			t.Errorf("durationText(%v) returned %q, want %q", test.duration, got, test.want)
+		}
+	}
+}
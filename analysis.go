@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// Everything the bot worked out about one board
+type Analysis struct {
+	Grid      string           `json:"grid"`
+	GameState GameState        `json:"game_state"`
+	Moves     []MoveEvaluation `json:"moves"`
+	BestMove  string           `json:"best_move"`
+	MustTurn  bool             `json:"must_turn"`
+	Position  string           `json:"position,omitempty"`
+}
+
+// Run the image processing pipeline on a board image and analyse the result,
+// reporting progress to a writer
+func analyzeBoardImage(imageData image.Image, boardWidth, boardHeight int, palette Palette, progress io.Writer) (Analysis, error) {
+	croppedImageData, err := autocropImage(imageData)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("failed to autocrop image: %v", err)
+	}
+
+	fmt.Fprintln(progress, "Image cropped")
+
+	imageGrid, err := imageToGridImages(croppedImageData, boardWidth, boardHeight)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("failed to convert image to grid images: %v", err)
+	}
+
+	fmt.Fprintln(progress, "Image converted to grid images")
+
+	snakeSpaceGrid, err := convertImageGridToSnakeSpaceGrid(imageGrid, palette)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("failed to convert image grid to SnakeSpace grid: %v", err)
+	}
+
+	fmt.Fprintln(progress, "Image grid converted to SnakeSpace grid")
+
+	gameState, err := convertSnakeSpaceGridToGameState(snakeSpaceGrid)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("failed to convert SnakeSpace grid to game state: %v", err)
+	}
+
+	// A board misread from the image mustn't turn into a recommendation
+	if err := gameState.Validate(); err != nil {
+		return Analysis{}, err
+	}
+
+	fmt.Fprintln(progress, "SnakeSpace grid converted to game state")
+
+	return analyzeGameState(gameState, progress)
+}
+
+// Run the AI on a game state, reporting progress to a writer
+func analyzeGameState(gameState GameState, progress io.Writer) (Analysis, error) {
+	grid, err := UnicodeRenderer{}.RenderBoard(gameState)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	for _, evaluation := range evaluateMoves(gameState) {
+		fmt.Fprintln(progress, "Move:", evaluation.Move, "Score:", evaluation.Score)
+	}
+	bestMove, mustTurn := determineNextMove(gameState)
+
+	fmt.Fprintln(progress, "Best move determined")
+
+	// A board read from an image can be too broken to write down
+	position, err := encodePosition(gameState)
+	if err != nil {
+		fmt.Fprintln(progress, "Failed to write the position down:", err)
+	}
+
+	return Analysis{
+		Grid:      grid,
+		GameState: gameState,
+		Moves:     rankMoves(gameState),
+		BestMove:  bestMove,
+		MustTurn:  mustTurn,
+		Position:  position,
+	}, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Colours of the analysis overlay. They only go on the bot's own images, so
+// they don't need to stay clear of the palette snakebot draws in.
+var dangerColor = color{0xD0, 0x30, 0x30}
+var arrowColor = color{0xF0, 0xA0, 0x00}
+var pathColor = color{0xFF, 0xE0, 0x60}
+
+// How strongly deadly squares are tinted, out of 255
+const dangerShade = 0x70
+
+// The size of a board space in the analysis image
+const analysisCellSize = 48
+
+// Mastodon's limit on the length of alt text
+const maxAltTextLength = 1500
+
+// Draw the board with the analysis on top: deadly squares next to the head
+// are tinted red, the recommended move is an arrow from the head, and dots
+// mark where the head goes over the next few moves.
+func renderAnalysisImage(game GameState, moves []MoveEvaluation, bestMove string, cellSize int) (*image.RGBA, error) {
+	img, err := renderGameStateImage(game, cellSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cellRect := func(pos Position) image.Rectangle {
+		return image.Rect(pos.X*cellSize, pos.Y*cellSize, (pos.X+1)*cellSize, (pos.Y+1)*cellSize)
+	}
+	center := func(pos Position) image.Point {
+		return image.Pt(pos.X*cellSize+cellSize/2, pos.Y*cellSize+cellSize/2)
+	}
+
+	for _, square := range dangerSquares(game, moves) {
+		shadeRect(img, cellRect(square), dangerColor, dangerShade)
+	}
+
+	// The path is a dotted trail between square centres
+	head := snakeHead(game)
+	path := plannedPath(game, bestMove, plannedPathLength)
+	dot := cellSize / 8
+	if dot < 1 {
+		dot = 1
+	}
+	previous := center(head)
+	for idx, pos := range path {
+		here := center(pos)
+		if idx > 0 {
+			for step := 1; step < 4; step++ {
+				p := previous.Add(here.Sub(previous).Mul(step).Div(4))
+				fillRect(img, image.Rect(p.X-dot/2, p.Y-dot/2, p.X+dot/2+1, p.Y+dot/2+1), pathColor)
+			}
+		}
+		fillRect(img, image.Rect(here.X-dot, here.Y-dot, here.X+dot, here.Y+dot), pathColor)
+		previous = here
+	}
+
+	if bestMove != "" {
+		drawArrow(img, center(head), bestMove, cellSize, arrowColor)
+	}
+
+	return img, nil
+}
+
+// The squares next to the head which the deadly moves lead into. A move into
+// the wall has no square to shade.
+func dangerSquares(game GameState, moves []MoveEvaluation) []Position {
+	squares := []Position{}
+	for _, evaluation := range moves {
+		if !evaluation.Deadly {
+			continue
+		}
+		square := snakeHead(moveInDirection(game, evaluation.Move))
+		if square.X >= 0 && square.Y >= 0 && square.X < game.BoardWidth && square.Y < game.BoardHeight {
+			squares = append(squares, square)
+		}
+	}
+	return squares
+}
+
+// Mix a colour into a rectangle of the image. Alpha is out of 255.
+func shadeRect(img *image.RGBA, rect image.Rectangle, c color, alpha uint32) {
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			old := img.RGBAAt(x, y)
+			mix := func(from uint8, to uint32) uint8 {
+				return uint8((uint32(from)*(255-alpha) + to*alpha) / 255)
+			}
+			old.R, old.G, old.B = mix(old.R, c.r), mix(old.G, c.g), mix(old.B, c.b)
+			img.SetRGBA(x, y, old)
+		}
+	}
+}
+
+// Draw an arrow from a point, one board space long, pointing in a direction
+func drawArrow(img *image.RGBA, from image.Point, direction string, cellSize int, c color) {
+	var along image.Point
+	switch direction {
+	case "up":
+		along = image.Pt(0, -1)
+	case "down":
+		along = image.Pt(0, 1)
+	case "left":
+		along = image.Pt(-1, 0)
+	case "right":
+		along = image.Pt(1, 0)
+	default:
+		return
+	}
+	across := image.Pt(along.Y, along.X)
+
+	length := cellSize * 3 / 4
+	shaft := cellSize / 10
+	if shaft < 1 {
+		shaft = 1
+	}
+	headLength := cellSize / 3
+
+	// The shaft, then the head narrowing to the tip
+	for step := 0; step <= length; step++ {
+		width := shaft
+		if step > length-headLength {
+			width = (length - step) * cellSize / 4 / headLength
+		}
+		p := from.Add(along.Mul(step))
+		for offset := -width; offset <= width; offset++ {
+			q := p.Add(across.Mul(offset))
+			fillRect(img, image.Rect(q.X, q.Y, q.X+1, q.Y+1), c)
+		}
+	}
+}
+
+// Alt text for the analysis image, for people using screen readers. The
+// board is described in the given style, which is prose unless told
+// otherwise, followed by what's drawn over it.
+func analysisAltText(game GameState, moves []MoveEvaluation, bestMove string, renderer BoardRenderer) string {
+	lines := []string{
+		fmt.Sprintf("A snake board %d squares wide and %d high. Columns are lettered from A on the left and rows numbered from 1 at the top.", game.BoardWidth, game.BoardHeight),
+	}
+
+	if board, err := renderer.RenderBoard(game); err == nil {
+		lines = append(lines, board)
+	}
+
+	if bestMove != "" {
+		lines = append(lines, "An arrow from the head points "+bestMove+", the move I recommend.")
+	}
+	if path := plannedPath(game, bestMove, plannedPathLength); len(path) > 1 {
+		squares := []string{}
+		for _, pos := range path {
+			squares = append(squares, squareName(pos))
+		}
+		lines = append(lines, "Dots mark the path I'd plan from there: "+strings.Join(squares, ", ")+".")
+	}
+
+	for _, evaluation := range moves {
+		if evaluation.Deadly {
+			lines = append(lines, fmt.Sprintf("Moving %s is deadly: the snake would %s.", evaluation.Move, evaluation.Danger))
+		}
+	}
+	if len(dangerSquares(game, moves)) > 0 {
+		lines = append(lines, "The squares those moves lead into are shaded red.")
+	}
+
+	alt := strings.Join(lines, " ")
+	if runes := []rune(alt); len(runes) > maxAltTextLength {
+		alt = string(runes[:maxAltTextLength-1]) + "…"
+	}
+	return alt
+}
+
+// Render the analysis image and upload it with its alt text. Returns the
+// ID of the attachment to post with.
+func uploadAnalysisImage(ctx context.Context, uploader MediaUploader, analysis Analysis, altStyle BoardRenderer) (mastodon.ID, error) {
+	img, err := renderAnalysisImage(analysis.GameState, analysis.Moves, analysis.BestMove, analysisCellSize)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+
+	attachment, err := uploader.UploadMediaFromMedia(ctx, &mastodon.Media{
+		File:        &buf,
+		Description: analysisAltText(analysis.GameState, analysis.Moves, analysis.BestMove, altStyle),
+	})
+	if err != nil {
+		return "", err
+	}
+	return attachment.ID, nil
+}
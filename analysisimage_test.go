@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderAnalysisImage(t *testing.T) {
+	// setup game state: heading right into the wall, so it must turn up
+	game := GameState{
+		BoardWidth:  8,
+		BoardHeight: 5,
+		SnakeShape: []Position{
+			{X: 7, Y: 2}, // Head
+			{X: 6, Y: 2},
+			{X: 5, Y: 2},
+			{X: 5, Y: 3},
+		},
+		Food:      Position{X: 7, Y: 0},
+		Direction: "right",
+	}
+	moves := evaluateMoves(game)
+	cellSize := 40
+
+	// call function to test
+	img, err := renderAnalysisImage(game, moves, "up", cellSize)
+	if err != nil {
+		t.Fatalf("renderAnalysisImage returned error %v", err)
+	}
+
+	// check result: the arrow leaves the head upwards
+	arrow := img.RGBAAt(7*cellSize+cellSize/2, 2*cellSize+cellSize/4)
+	if arrow.R != uint8(arrowColor.r) || arrow.G != uint8(arrowColor.g) || arrow.B != uint8(arrowColor.b) {
+		t.Errorf("pixel above the head is %v, want the arrow colour", arrow)
+	}
+
+	// the square behind the head is deadly, so it's tinted red
+	plain, _ := renderGameStateImage(game, cellSize)
+	corner := img.RGBAAt(6*cellSize+1, 2*cellSize+1)
+	plainCorner := plain.RGBAAt(6*cellSize+1, 2*cellSize+1)
+	if corner.R <= plainCorner.R || corner.G >= plainCorner.G {
+		t.Errorf("deadly square is %v, want it redder than %v", corner, plainCorner)
+	}
+
+	// safe squares are left alone
+	if img.RGBAAt(1, 1) != plain.RGBAAt(1, 1) {
+		t.Errorf("safe square is %v, want %v", img.RGBAAt(1, 1), plain.RGBAAt(1, 1))
+	}
+}
+
+func TestAnalysisAltText(t *testing.T) {
+	// setup game state
+	game := GameState{
+		BoardWidth:  8,
+		BoardHeight: 5,
+		SnakeShape: []Position{
+			{X: 7, Y: 2}, // Head
+			{X: 6, Y: 2},
+			{X: 5, Y: 2},
+			{X: 5, Y: 3},
+		},
+		Food:      Position{X: 7, Y: 0},
+		Direction: "right",
+	}
+
+	// call function to test
+	result := analysisAltText(game, evaluateMoves(game), "up", ProseRenderer{})
+
+	// check result
+	for _, want := range []string{
+		"8 squares wide and 5 high",
+		"Head at H3 facing right, food at H1, 4 segments: H3, G3, F3, with the tail at F4.",
+		"points up",
+		"path I'd plan from there: H2, H1.",
+		"Moving right is deadly: the snake would crash into the wall.",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("analysisAltText returned %q, want it to contain %q", result, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+type ArchiveRecordKind string
+
+const (
+	ArchiveStatus ArchiveRecordKind = "status"
+	ArchivePoll   ArchiveRecordKind = "poll"
+)
+
+// One line of an archive file. Archives are JSON lines files which record
+// what the bot saw, so that it can be replayed later. Poll records are
+// snapshots of the vote counts taken at each check-in, with how far through
+// the poll they were taken.
+type ArchiveRecord struct {
+	Time    time.Time         `json:"time"`
+	Kind    ArchiveRecordKind `json:"kind"`
+	Status  *mastodon.Status  `json:"status,omitempty"`
+	Poll    *mastodon.Poll    `json:"poll,omitempty"`
+	Elapsed float64           `json:"elapsed,omitempty"`
+}
+
+// Appends records to an archive file. Safe to use from several goroutines.
+// Mastodon deletes media after a while, so the images of archived statuses
+// can be kept in a media directory too, for replays.
+type ArchiveWriter struct {
+	mutex    sync.Mutex
+	file     *os.File
+	mediaDir string
+	clock    Clock
+}
+
+// Open an archive file for appending, saving images in mediaDir unless it's
+// empty. Records are timed by the clock.
+func openArchiveWriter(filename, mediaDir string, clock Clock) (*ArchiveWriter, error) {
+	if mediaDir != "" {
+		if err := os.MkdirAll(mediaDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{file: file, mediaDir: mediaDir, clock: clock}, nil
+}
+
+func (a *ArchiveWriter) write(record ArchiveRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+func (a *ArchiveWriter) writeStatus(status *mastodon.Status) error {
+	if a.mediaDir != "" {
+		for _, attachment := range status.MediaAttachments {
+			if attachment.Type != "image" {
+				continue
+			}
+			if err := saveMedia(attachment.URL, archivedMediaFile(a.mediaDir, attachment)); err != nil {
+				fmt.Println("Failed to save image", attachment.ID, "for the archive:", err)
+			}
+		}
+	}
+	return a.write(ArchiveRecord{Time: a.clock.Now(), Kind: ArchiveStatus, Status: status})
+}
+
+func (a *ArchiveWriter) writePoll(poll *mastodon.Poll, elapsed float64) error {
+	return a.write(ArchiveRecord{Time: a.clock.Now(), Kind: ArchivePoll, Poll: poll, Elapsed: elapsed})
+}
+
+// Where an attachment's image is kept in a media directory
+func archivedMediaFile(mediaDir string, attachment mastodon.Attachment) string {
+	ext := ".png"
+	if parsed, err := url.Parse(attachment.URL); err == nil && path.Ext(parsed.Path) != "" {
+		ext = path.Ext(parsed.Path)
+	}
+	return filepath.Join(mediaDir, string(attachment.ID)+ext)
+}
+
+// Download a file as it is
+func saveMedia(mediaURL, filename string) error {
+	response, err := imageClient.Get(mediaURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", mediaURL, response.Status)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, io.LimitReader(response.Body, maxImageBytes)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// The image of an archived attachment: the copy in the media directory if
+// there is one, or else downloaded again
+func archivedImage(mediaDir string, attachment mastodon.Attachment) (image.Image, error) {
+	if mediaDir != "" {
+		imageData, err := loadImageFromDisk(archivedMediaFile(mediaDir, attachment))
+		if err == nil {
+			return imageData, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return downloadImage(attachment.URL)
+}
+
+func readArchive(filename string) ([]ArchiveRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []ArchiveRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record ArchiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, lineNumber, err)
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Replays the statuses in an archive as stream events, so that the bot can
+// run on recorded games. The channel is closed after the last status.
+type ArchiveEvents struct {
+	Records []ArchiveRecord
+}
+
+func (a ArchiveEvents) Events(ctx context.Context) (chan mastodon.Event, error) {
+	q := make(chan mastodon.Event)
+	go func() {
+		defer close(q)
+		for _, record := range a.Records {
+			if record.Kind != ArchiveStatus || record.Status == nil {
+				continue
+			}
+			select {
+			case q <- &mastodon.UpdateEvent{Status: record.Status}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return q, nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A board drawn as text, in the unicode, ASCII or emoji style of the board
+// renderers, can be read back into a game state. This lets test cases be
+// written as small drawings:
+//
+//	##########
+//	#.......@#
+//	#........#
+//	#.....+->#
+//	#.....o..#
+//	#........#
+//	##########
+//
+// The border is optional, and so is indentation. Where a drawing leaves the
+// shape of the snake open, such as at an ASCII corner or an emoji segment,
+// the snake is traced from the head to the tail through every segment.
+
+// One space of a drawing
+type drawnCell struct {
+	kind SnakeSlot
+	// The sides the segment connects on, where the drawing shows them
+	sides Adjacencies
+	// Whether the drawing shows a corner without saying which one
+	corner bool
+	// Whether the drawing marks this as the end of the tail
+	tail bool
+	// The way the head faces, where the drawing shows it
+	direction string
+}
+
+// What each character of a drawing stands for
+var drawingCells = map[rune]drawnCell{
+	// The unicode style
+	'░': {kind: Empty},
+	'▒': {kind: Empty},
+	'▖': {kind: Food},
+	'╋': {kind: Head},
+	'▲': {kind: Head, direction: "up"},
+	'▼': {kind: Head, direction: "down"},
+	'◀': {kind: Head, direction: "left"},
+	'▶': {kind: Head, direction: "right"},
+	'●': {kind: Snake, tail: true},
+	'╹': {kind: Snake, sides: Up},
+	'╻': {kind: Snake, sides: Down},
+	'╸': {kind: Snake, sides: Left},
+	'╺': {kind: Snake, sides: Right},
+	'║': {kind: Snake, sides: Up | Down},
+	'═': {kind: Snake, sides: Left | Right},
+	'╚': {kind: Snake, sides: Up | Right},
+	'╝': {kind: Snake, sides: Up | Left},
+	'╔': {kind: Snake, sides: Down | Right},
+	'╗': {kind: Snake, sides: Down | Left},
+
+	// The ASCII style
+	'.': {kind: Empty},
+	'@': {kind: Food},
+	'^': {kind: Head, direction: "up"},
+	'v': {kind: Head, direction: "down"},
+	'<': {kind: Head, direction: "left"},
+	'>': {kind: Head, direction: "right"},
+	'O': {kind: Head},
+	'|': {kind: Snake, sides: Up | Down},
+	'-': {kind: Snake, sides: Left | Right},
+	'+': {kind: Snake, corner: true},
+	'o': {kind: Snake, tail: true},
+
+	// The emoji style
+	'⬜': {kind: Empty},
+	'🍎': {kind: Food},
+	'👆': {kind: Head, direction: "up"},
+	'👇': {kind: Head, direction: "down"},
+	'👈': {kind: Head, direction: "left"},
+	'👉': {kind: Head, direction: "right"},
+	'🟢': {kind: Head},
+	'🟦': {kind: Snake},
+	'🟩': {kind: Snake, tail: true},
+}
+
+// Borders around the board, which are skipped
+var drawingBorders = map[rune]bool{
+	'┌': true, '┐': true, '└': true, '┘': true, '─': true, '│': true, '#': true,
+}
+
+// The sides of a space, in the order the snake is traced
+var drawingSides = []Adjacencies{Up, Down, Left, Right}
+
+var sideDirections = map[Adjacencies]string{Up: "up", Down: "down", Left: "left", Right: "right"}
+
+func oppositeSide(side Adjacencies) Adjacencies {
+	switch side {
+	case Up:
+		return Down
+	case Down:
+		return Up
+	case Left:
+		return Right
+	case Right:
+		return Left
+	}
+	return UndefAdj
+}
+
+func stepTowards(pos Position, side Adjacencies) Position {
+	switch side {
+	case Up:
+		pos.Y--
+	case Down:
+		pos.Y++
+	case Left:
+		pos.X--
+	case Right:
+		pos.X++
+	}
+	return pos
+}
+
+// Read a board drawing into a SnakeSpace grid and the game state it shows
+func parseBoardDrawing(drawing string) ([][]SnakeSpace, GameState, error) {
+	cells, err := readDrawingCells(drawing)
+	if err != nil {
+		return nil, GameState{}, err
+	}
+
+	game := GameState{BoardHeight: len(cells), BoardWidth: len(cells[0])}
+	var head Position
+	heads, foods, segments := 0, 0, 0
+	for y, row := range cells {
+		for x, cell := range row {
+			switch cell.kind {
+			case Head:
+				heads++
+				head = Position{X: x, Y: y}
+				game.Direction = cell.direction
+			case Food:
+				foods++
+				game.Food = Position{X: x, Y: y}
+			case Snake:
+				segments++
+			}
+		}
+	}
+	if heads != 1 {
+		return nil, GameState{}, fmt.Errorf("the drawing has %d snake heads, want 1", heads)
+	}
+	if foods != 1 {
+		return nil, GameState{}, fmt.Errorf("the drawing has %d pieces of food, want 1", foods)
+	}
+
+	game.SnakeShape, err = traceSnake(cells, head, segments+1)
+	if err != nil {
+		return nil, GameState{}, err
+	}
+
+	// Without an arrow for a head, the snake is heading away from its neck
+	if game.Direction == "" {
+		if len(game.SnakeShape) < 2 {
+			return nil, GameState{}, errors.New("can't tell which way a snake with no body is heading")
+		}
+		game.Direction = sideDirections[oppositeSide(adjacencyTowards(game.SnakeShape[0], game.SnakeShape[1]))]
+	}
+	if err := game.Validate(); err != nil {
+		return nil, GameState{}, err
+	}
+
+	snakeSpaceGrid, err := convertGameStateToSnakeSpaceGrid(game)
+	if err != nil {
+		return nil, GameState{}, err
+	}
+	return snakeSpaceGrid, game, nil
+}
+
+// Split a drawing into rows of cells, leaving out the border and any
+// indentation
+func readDrawingCells(drawing string) ([][]drawnCell, error) {
+	cells := [][]drawnCell{}
+	for _, line := range strings.Split(drawing, "\n") {
+		line = strings.TrimFunc(line, unicode.IsSpace)
+		row := []drawnCell{}
+		for _, r := range line {
+			// Emoji variation selectors don't change anything
+			if drawingBorders[r] || r == '\uFE0F' {
+				continue
+			}
+			cell, ok := drawingCells[r]
+			if !ok {
+				return nil, fmt.Errorf("unknown character %q in board drawing", r)
+			}
+			row = append(row, cell)
+		}
+		if len(row) == 0 {
+			continue
+		}
+		if len(cells) > 0 && len(row) != len(cells[0]) {
+			return nil, fmt.Errorf("row %d of the drawing is %d spaces wide, want %d", len(cells)+1, len(row), len(cells[0]))
+		}
+		cells = append(cells, row)
+	}
+	if len(cells) == 0 {
+		return nil, errors.New("the drawing has no board")
+	}
+	return cells, nil
+}
+
+// How many steps tracing a snake may take before giving up. A drawing which
+// leaves most of a big snake's shape open, such as a mass of ASCII corners
+// or emoji, can have far too many ways through it to try them all.
+const maxTraceSteps = 100000
+
+// Find the order of the snake's segments, head first, by following the
+// drawing from the head through every segment. Each segment has to join
+// its neighbours on the sides the drawing shows, and a marked tail has to
+// come last.
+func traceSnake(cells [][]drawnCell, head Position, length int) ([]Position, error) {
+	inBoard := func(pos Position) bool {
+		return pos.Y >= 0 && pos.Y < len(cells) && pos.X >= 0 && pos.X < len(cells[0])
+	}
+
+	path := []Position{head}
+	visited := map[Position]bool{head: true}
+
+	// Whether a segment entered on one side may be left on another
+	canLeave := func(cell drawnCell, entered, leaving Adjacencies) bool {
+		switch {
+		case cell.sides != UndefAdj:
+			return cell.sides == entered|leaving
+		case cell.corner:
+			return entered|leaving != Up|Down && entered|leaving != Left|Right
+		}
+		return true
+	}
+
+	steps := 0
+	var extend func(entered Adjacencies) bool
+	extend = func(entered Adjacencies) bool {
+		steps++
+		if steps > maxTraceSteps {
+			return false
+		}
+		current := path[len(path)-1]
+		cell := cells[current.Y][current.X]
+
+		if len(path) == length {
+			// The tail only joins the segment before it
+			if cell.kind == Head {
+				return true
+			}
+			return !cell.corner && (cell.sides == UndefAdj || cell.sides == entered)
+		}
+		if cell.kind == Snake && cell.tail {
+			return false
+		}
+
+		for _, side := range drawingSides {
+			next := stepTowards(current, side)
+			if !inBoard(next) || visited[next] || cells[next.Y][next.X].kind != Snake {
+				continue
+			}
+			if cell.kind == Head {
+				if cell.direction != "" && side != oppositeSide(directionSide(cell.direction)) {
+					continue
+				}
+			} else if !canLeave(cell, entered, side) {
+				continue
+			}
+			if sides := cells[next.Y][next.X].sides; sides != UndefAdj && sides&oppositeSide(side) == 0 {
+				continue
+			}
+
+			path = append(path, next)
+			visited[next] = true
+			if extend(oppositeSide(side)) {
+				return true
+			}
+			path = path[:len(path)-1]
+			delete(visited, next)
+		}
+		return false
+	}
+
+	if !extend(UndefAdj) {
+		if steps > maxTraceSteps {
+			return nil, fmt.Errorf("gave up tracing the snake after %d steps", maxTraceSteps)
+		}
+		return nil, errors.New("can't trace the snake from its head through every segment")
+	}
+	return path, nil
+}
+
+// The side of a space in a direction
+func directionSide(direction string) Adjacencies {
+	for side, name := range sideDirections {
+		if name == direction {
+			return side
+		}
+	}
+	return UndefAdj
+}
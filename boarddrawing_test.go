@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Read a board drawing for a test case, which has to be right
+func mustParseBoardDrawing(drawing string) GameState {
+	_, game, err := parseBoardDrawing(drawing)
+	if err != nil {
+		panic(err)
+	}
+	return game
+}
+
+func TestParseBoardDrawing(t *testing.T) {
+	// setup
+	want := GameState{
+		BoardWidth:  8,
+		BoardHeight: 5,
+		SnakeShape: []Position{
+			{X: 7, Y: 2}, // Head
+			{X: 6, Y: 2},
+			{X: 5, Y: 2},
+			{X: 5, Y: 3}, // Tail
+		},
+		Food:      Position{X: 7, Y: 0},
+		Direction: "right",
+	}
+	drawings := map[string]string{
+		"unicode": `
+			┌────────┐
+			│░▒░▒░▒░▖│
+			│▒░▒░▒░▒░│
+			│░▒░▒░╔═▶│
+			│▒░▒░▒●▒░│
+			│░▒░▒░▒░▒│
+			└────────┘`,
+		"ascii": `
+			.......@
+			........
+			.....+->
+			.....o..
+			........`,
+		"emoji": `
+			⬜⬜⬜⬜⬜⬜⬜🍎
+			⬜⬜⬜⬜⬜⬜⬜⬜
+			⬜⬜⬜⬜⬜🟦🟦👉
+			⬜⬜⬜⬜⬜🟩⬜⬜
+			⬜⬜⬜⬜⬜⬜⬜⬜`,
+	}
+
+	for style, drawing := range drawings {
+		// call function to test
+		snakeSpaceGrid, game, err := parseBoardDrawing(drawing)
+
+		// check result
+		if err != nil {
+			t.Errorf("parseBoardDrawing(%s) returned error %v", style, err)
+			continue
+		}
+		if !equalGameStates(game, want) {
+			t.Errorf("parseBoardDrawing(%s) returned %v, want %v", style, game, want)
+		}
+		if snakeSpaceGrid[2][7].SnakeSlot != Head || snakeSpaceGrid[2][6].Adjacencies != Left|Right {
+			t.Errorf("parseBoardDrawing(%s) returned a grid without the snake in place", style)
+		}
+	}
+}
+
+func TestParseBoardDrawingTracesAmbiguousShapes(t *testing.T) {
+	// setup: the snake doubles back on itself, so several segments touch
+	// segments they don't join
+	drawing := `
+		+-+.....
+		|.|.....
+		|.+-->..
+		+-o.....
+		.......@`
+	want := []Position{
+		{X: 5, Y: 2}, {X: 4, Y: 2}, {X: 3, Y: 2}, {X: 2, Y: 2}, {X: 2, Y: 1}, {X: 2, Y: 0},
+		{X: 1, Y: 0}, {X: 0, Y: 0}, {X: 0, Y: 1}, {X: 0, Y: 2}, {X: 0, Y: 3}, {X: 1, Y: 3}, {X: 2, Y: 3},
+	}
+
+	// call function to test
+	_, game, err := parseBoardDrawing(drawing)
+
+	// check result
+	if err != nil {
+		t.Fatalf("parseBoardDrawing returned error %v", err)
+	}
+	if !equalPositions(game.SnakeShape, want) || game.Direction != "right" {
+		t.Errorf("parseBoardDrawing returned %v heading %s, want %v heading right", game.SnakeShape, game.Direction, want)
+	}
+}
+
+func TestParseBoardDrawingRejectsBadDrawings(t *testing.T) {
+	// setup
+	drawings := map[string]string{
+		"no food":         "..>-o",
+		"two heads":       "@.>-o\n..<-o",
+		"uneven rows":     "@...\n>-o",
+		"unknown":         "@.>-x",
+		"broken snake":    "@>-.o",
+		"tail in between": "@>o-o",
+		"no board":        "\n\n",
+	}
+
+	for name, drawing := range drawings {
+		// call function to test
+		_, _, err := parseBoardDrawing(drawing)
+
+		// check result
+		if err == nil {
+			t.Errorf("parseBoardDrawing returned no error for a drawing with %s", name)
+		}
+	}
+}
+
+func TestParseBoardDrawingGivesUpOnTangledSnakes(t *testing.T) {
+	// setup: a board full of emoji snake which can't be traced, since the
+	// food takes a square of the head's colour and leaves too few of them
+	rows := []string{}
+	for y := 0; y < 10; y++ {
+		rows = append(rows, strings.Repeat("🟦", 10))
+	}
+	rows[0] = "🟢" + strings.Repeat("🟦", 9)
+	rows[1] = "🟦🍎" + strings.Repeat("🟦", 8)
+
+	// call function to test
+	start := time.Now()
+	_, _, err := parseBoardDrawing(strings.Join(rows, "\n"))
+
+	// check result
+	if err == nil {
+		t.Errorf("parseBoardDrawing returned no error for a snake which can't be traced")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("parseBoardDrawing took %v to give up", elapsed)
+	}
+}
+
+func TestBoardDrawingsRoundTrip(t *testing.T) {
+	// setup: positions from games the AI plays
+	rng := rand.New(rand.NewSource(7))
+	games := []GameState{}
+	for len(games) < 50 {
+		game := newGameState(8, 5, rng)
+		for turn := 0; turn < 40; turn++ {
+			next, _, died := simulateStep(game, rankMoves(game)[0].Move, rng)
+			if died {
+				break
+			}
+			game = next
+			if len(game.SnakeShape) > 1 {
+				games = append(games, game)
+			}
+		}
+	}
+
+	for _, renderer := range []BoardRenderer{UnicodeRenderer{}, ASCIIRenderer{}, EmojiRenderer{}} {
+		for _, game := range games {
+			drawing, err := renderer.RenderBoard(game)
+			if err != nil {
+				t.Fatalf("%T.RenderBoard returned error %v", renderer, err)
+			}
+
+			// call function to test
+			_, result, err := parseBoardDrawing(drawing)
+
+			// check result
+			if err != nil {
+				t.Errorf("parseBoardDrawing returned error %v for\n%s", err, drawing)
+			} else if !equalGameStates(result, game) {
+				t.Errorf("parseBoardDrawing returned %v, want %v for\n%s", result, game, drawing)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Draws a board as text
+type BoardRenderer interface {
+	RenderBoard(game GameState) (string, error)
+}
+
+// The box drawing style the bot has always posted. The head is an arrow
+// pointing the way the snake is heading and the tail is a dot.
+//
+//	┌────────┐
+//	│░▒░▒░▒░▖│
+//	│▒░▒░▒░▒░│
+//	│░▒░▒░╔═▶│
+//	│▒░▒░▒●▒░│
+//	│░▒░▒░▒░▒│
+//	└────────┘
+type UnicodeRenderer struct{}
+
+var unicodeHeads = map[string]string{"up": "▲", "down": "▼", "left": "◀", "right": "▶"}
+
+// The segments between the head and the tail, by the sides they join
+var unicodeSegments = map[Adjacencies]string{
+	Up | Down:    "║",
+	Left | Right: "═",
+	Up | Right:   "╚",
+	Up | Left:    "╝",
+	Down | Right: "╔",
+	Down | Left:  "╗",
+}
+
+func (UnicodeRenderer) RenderBoard(game GameState) (string, error) {
+	var drawErr error
+	board, err := renderBoardCells(game, "", func(cell boardCell) string {
+		switch cell.kind {
+		case Head:
+			if head, ok := unicodeHeads[game.Direction]; ok {
+				return head
+			}
+			return "╋"
+		case Snake:
+			if cell.tail {
+				return "●"
+			}
+			segment, ok := unicodeSegments[cell.adjacencies]
+			if !ok && drawErr == nil {
+				drawErr = fmt.Errorf("can't draw a snake segment joined on sides %d", cell.adjacencies)
+			}
+			return segment
+		case Food:
+			return "▖"
+		case Empty:
+			if cell.dark {
+				return "▒"
+			}
+		}
+		return "░"
+	})
+	if err != nil {
+		return "", err
+	}
+	if drawErr != nil {
+		return "", drawErr
+	}
+
+	edge := strings.Repeat("─", game.BoardWidth)
+	rows := []string{"┌" + edge + "┐"}
+	for _, row := range strings.Split(board, "\n") {
+		rows = append(rows, "│"+row+"│")
+	}
+	return strings.Join(append(rows, "└"+edge+"┘"), "\n"), nil
+}
+
+// Plain ASCII for clients and logs which mangle anything else. The head
+// points the way the snake is heading and the tail is an o.
+//
+//	##########
+//	#.......@#
+//	#........#
+//	#.....+->#
+//	#.....o..#
+//	#........#
+//	##########
+type ASCIIRenderer struct{}
+
+var asciiHeads = map[string]string{"up": "^", "down": "v", "left": "<", "right": ">"}
+
+func (ASCIIRenderer) RenderBoard(game GameState) (string, error) {
+	return renderBoardCells(game, "#", func(cell boardCell) string {
+		switch cell.kind {
+		case Head:
+			if head, ok := asciiHeads[game.Direction]; ok {
+				return head
+			}
+			return "O"
+		case Snake:
+			switch {
+			case cell.tail:
+				return "o"
+			case cell.adjacencies == Up|Down:
+				return "|"
+			case cell.adjacencies == Left|Right:
+				return "-"
+			default:
+				return "+"
+			}
+		case Food:
+			return "@"
+		default:
+			return "."
+		}
+	})
+}
+
+// Emoji, one square per space. The head is a hand pointing the way the
+// snake is heading.
+type EmojiRenderer struct{}
+
+var emojiHeads = map[string]string{"up": "👆", "down": "👇", "left": "👈", "right": "👉"}
+
+func (EmojiRenderer) RenderBoard(game GameState) (string, error) {
+	return renderBoardCells(game, "", func(cell boardCell) string {
+		switch cell.kind {
+		case Head:
+			if head, ok := emojiHeads[game.Direction]; ok {
+				return head
+			}
+			return "🟢"
+		case Snake:
+			if cell.tail {
+				return "🟩"
+			}
+			return "🟦"
+		case Food:
+			return "🍎"
+		default:
+			return "⬜"
+		}
+	})
+}
+
+// A description in words, for alt text and screen readers: where the head
+// is and which way it faces, where the food is, and every segment of the
+// snake.
+type ProseRenderer struct{}
+
+func (ProseRenderer) RenderBoard(game GameState) (string, error) {
+	if err := game.Validate(); err != nil {
+		return "", err
+	}
+
+	head := game.SnakeShape[0]
+	text := "Head at " + squareName(head)
+	if game.Direction != "" {
+		text += " facing " + game.Direction
+	}
+	text += ", food at " + squareName(game.Food)
+	if len(game.SnakeShape) == 1 {
+		return text + ", 1 segment.", nil
+	}
+
+	squares := []string{}
+	for _, pos := range game.SnakeShape {
+		squares = append(squares, squareName(pos))
+	}
+	return fmt.Sprintf("%s, %d segments: %s, with the tail at %s.", text, len(game.SnakeShape), strings.Join(squares[:len(squares)-1], ", "), squares[len(squares)-1]), nil
+}
+
+// A square's name, as on a chess board but counting rows from the top:
+// columns are lettered from A on the left, then AA, AB and so on, and rows
+// numbered from 1. Positions are written this way in the notation too.
+func squareName(pos Position) string {
+	column := ""
+	for x := pos.X + 1; x > 0; x = (x - 1) / 26 {
+		column = string(rune('A'+(x-1)%26)) + column
+	}
+	return column + strconv.Itoa(pos.Y+1)
+}
+
+// What's in one space of the board
+type boardCell struct {
+	kind        SnakeSlot
+	adjacencies Adjacencies
+	tail        bool
+	// Whether the space is one of the darker squares of the checkerboard
+	dark bool
+}
+
+// Draw a board a character at a time, inside a border if there is one. A
+// board which isn't a possible game is an error, not something to guess at.
+func renderBoardCells(game GameState, border string, draw func(cell boardCell) string) (string, error) {
+	if err := game.Validate(); err != nil {
+		return "", err
+	}
+	snakeSpaceGrid, err := convertGameStateToSnakeSpaceGrid(game)
+	if err != nil {
+		return "", err
+	}
+	tail := game.SnakeShape[len(game.SnakeShape)-1]
+
+	rows := []string{}
+	if border != "" {
+		rows = append(rows, strings.Repeat(border, game.BoardWidth+2))
+	}
+	for y, row := range snakeSpaceGrid {
+		line := border
+		for x, snakeSpace := range row {
+			cell := boardCell{kind: snakeSpace.SnakeSlot, adjacencies: snakeSpace.Adjacencies}
+			cell.tail = snakeSpace.SnakeSlot == Snake && (Position{X: x, Y: y}) == tail
+			cell.dark = (x+y)%2 == 1
+			line += draw(cell)
+		}
+		rows = append(rows, line+border)
+	}
+	if border != "" {
+		rows = append(rows, strings.Repeat(border, game.BoardWidth+2))
+	}
+	return strings.Join(rows, "\n"), nil
+}
+
+// The text styles, by name
+var boardRenderers = map[string]BoardRenderer{
+	"unicode": UnicodeRenderer{},
+	"ascii":   ASCIIRenderer{},
+	"emoji":   EmojiRenderer{},
+	"prose":   ProseRenderer{},
+}
+
+func boardRendererNames() string {
+	names := []string{}
+	for name := range boardRenderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func parseBoardRenderer(name string) (BoardRenderer, error) {
+	renderer, ok := boardRenderers[strings.TrimSpace(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown board style %q, expected one of %s", name, boardRendererNames())
+	}
+	return renderer, nil
+}
+
+// Which style the board is drawn in for each place it goes
+type BoardStyles struct {
+	// In the text of analysis posts
+	Post BoardRenderer
+	// In the bot's log
+	Log BoardRenderer
+	// In the alt text of the analysis image
+	AltText BoardRenderer
+}
+
+func defaultBoardStyles() BoardStyles {
+	return BoardStyles{Post: UnicodeRenderer{}, Log: UnicodeRenderer{}, AltText: ProseRenderer{}}
+}
+
+// Fill in the defaults for any destinations without a style
+func (s BoardStyles) withDefaults() BoardStyles {
+	defaults := defaultBoardStyles()
+	if s.Post == nil {
+		s.Post = defaults.Post
+	}
+	if s.Log == nil {
+		s.Log = defaults.Log
+	}
+	if s.AltText == nil {
+		s.AltText = defaults.AltText
+	}
+	return s
+}
+
+// Parse a comma separated list of destinations and styles such as
+// "post=ascii,alt=prose". Destinations left out keep their default style.
+func parseBoardStyles(spec string) (BoardStyles, error) {
+	styles := defaultBoardStyles()
+	if strings.TrimSpace(spec) == "" {
+		return styles, nil
+	}
+	for _, field := range strings.Split(spec, ",") {
+		destination, name, ok := strings.Cut(field, "=")
+		if !ok {
+			return styles, fmt.Errorf("board style %q should be destination=style, such as post=ascii", field)
+		}
+		renderer, err := parseBoardRenderer(name)
+		if err != nil {
+			return styles, err
+		}
+		switch strings.TrimSpace(destination) {
+		case "post":
+			styles.Post = renderer
+		case "log":
+			styles.Log = renderer
+		case "alt":
+			styles.AltText = renderer
+		default:
+			return styles, fmt.Errorf("unknown board destination %q, expected post, log or alt", destination)
+		}
+	}
+	return styles, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// A snake heading right into the wall, with its tail hanging down
+var boardTextGame = GameState{
+	BoardWidth:  8,
+	BoardHeight: 5,
+	SnakeShape: []Position{
+		{X: 7, Y: 2}, // Head
+		{X: 6, Y: 2},
+		{X: 5, Y: 2},
+		{X: 5, Y: 3}, // Tail
+	},
+	Food:      Position{X: 7, Y: 0},
+	Direction: "right",
+}
+
+func TestBoardRenderers(t *testing.T) {
+	// setup
+	tests := []struct {
+		renderer BoardRenderer
+		want     string
+	}{
+		{UnicodeRenderer{}, strings.Join([]string{
+			"┌────────┐",
+			"│░▒░▒░▒░▖│",
+			"│▒░▒░▒░▒░│",
+			"│░▒░▒░╔═▶│",
+			"│▒░▒░▒●▒░│",
+			"│░▒░▒░▒░▒│",
+			"└────────┘",
+		}, "\n")},
+		{ASCIIRenderer{}, strings.Join([]string{
+			"##########",
+			"#.......@#",
+			"#........#",
+			"#.....+->#",
+			"#.....o..#",
+			"#........#",
+			"##########",
+		}, "\n")},
+		{EmojiRenderer{}, strings.Join([]string{
+			"⬜⬜⬜⬜⬜⬜⬜🍎",
+			"⬜⬜⬜⬜⬜⬜⬜⬜",
+			"⬜⬜⬜⬜⬜🟦🟦👉",
+			"⬜⬜⬜⬜⬜🟩⬜⬜",
+			"⬜⬜⬜⬜⬜⬜⬜⬜",
+		}, "\n")},
+		{ProseRenderer{}, "Head at H3 facing right, food at H1, 4 segments: H3, G3, F3, with the tail at F4."},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		result, err := test.renderer.RenderBoard(boardTextGame)
+
+		// check result
+		if err != nil {
+			t.Errorf("%T.RenderBoard returned error %v", test.renderer, err)
+		} else if result != test.want {
+			t.Errorf("%T.RenderBoard returned\n%s\nwant\n%s", test.renderer, result, test.want)
+		}
+	}
+}
+
+func TestBoardRenderersRejectInvalidGames(t *testing.T) {
+	// setup: food off the board
+	game := boardTextGame
+	game.Food = Position{X: 9, Y: 0}
+
+	for _, renderer := range boardRenderers {
+		// call function to test
+		_, err := renderer.RenderBoard(game)
+
+		// check result
+		if err == nil {
+			t.Errorf("%T.RenderBoard returned no error for food off the board", renderer)
+		}
+	}
+}
+
+func TestBoardRenderersRejectBrokenSnakes(t *testing.T) {
+	// setup: a tail which has come away from the rest of the snake
+	game := boardTextGame
+	game.SnakeShape = []Position{{X: 7, Y: 2}, {X: 6, Y: 2}, {X: 5, Y: 2}, {X: 4, Y: 4}}
+
+	for _, renderer := range boardRenderers {
+		// call function to test
+		board, err := renderer.RenderBoard(game)
+
+		// check result
+		if err == nil {
+			t.Errorf("%T.RenderBoard returned\n%s\nwant an error", renderer, board)
+		}
+	}
+}
+
+func TestUnicodeRendererPointsTheHead(t *testing.T) {
+	for _, want := range []string{"▲", "▼", "◀", "▶"} {
+		// setup: a two segment snake in the middle of the board, heading
+		// away from its tail
+		game := boardTextGame
+		heading := drawingCells[[]rune(want)[0]].direction
+		head := Position{X: 3, Y: 2}
+		game.SnakeShape = []Position{head, stepTowards(head, oppositeSide(directionSide(heading)))}
+		game.Direction = heading
+
+		// call function to test
+		board, err := UnicodeRenderer{}.RenderBoard(game)
+
+		// check result
+		if err != nil {
+			t.Fatalf("UnicodeRenderer.RenderBoard returned error %v", err)
+		}
+		if !strings.Contains(board, want) || !strings.Contains(board, "●") {
+			t.Errorf("UnicodeRenderer.RenderBoard heading %s returned\n%s\nwant the head drawn as %s and a tail", heading, board, want)
+		}
+	}
+}
+
+func TestParseBoardStyles(t *testing.T) {
+	// call function to test
+	styles, err := parseBoardStyles("post=ascii, alt=emoji")
+
+	// check result
+	if err != nil {
+		t.Fatalf("parseBoardStyles returned error %v", err)
+	}
+	if styles.Post != (ASCIIRenderer{}) || styles.Log != (UnicodeRenderer{}) || styles.AltText != (EmojiRenderer{}) {
+		t.Errorf("parseBoardStyles returned %#v, want ascii posts, unicode logs and emoji alt text", styles)
+	}
+
+	for _, spec := range []string{"post", "post=braille", "banner=ascii"} {
+		if _, err := parseBoardStyles(spec); err == nil {
+			t.Errorf("parseBoardStyles(%q) returned no error", spec)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// When to look at a poll. A check-in is either a fraction of the way through
+// the poll, a lead time before it expires, or adaptive, which is worked out
+// from the vote counts in the archive before the bot starts.
+type CheckIn struct {
+	Fraction float64
+	Lead     time.Duration
+	Adaptive bool
+}
+
+func (c CheckIn) String() string {
+	switch {
+	case c.Adaptive:
+		return "adaptive"
+	case c.Lead > 0:
+		return c.Lead.String()
+	default:
+		return strconv.FormatFloat(c.Fraction*100, 'f', -1, 64) + "%"
+	}
+}
+
+// The bot's check-ins unless told otherwise: once, shortly before expiry
+var defaultCheckIns = []CheckIn{{Lead: pollCheckLead}}
+
+// Parse a comma separated check-in schedule such as "50%,90%,98%",
+// "2m" or "50%,adaptive"
+func parseCheckIns(spec string) ([]CheckIn, error) {
+	checkIns := []CheckIn{}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			return nil, fmt.Errorf("empty check-in in %q", spec)
+		case field == "adaptive":
+			checkIns = append(checkIns, CheckIn{Adaptive: true})
+		case strings.HasSuffix(field, "%"):
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(field, "%"), 64)
+			if err != nil || percent <= 0 || percent >= 100 {
+				return nil, fmt.Errorf("check-in %q should be a percentage between 0%% and 100%%", field)
+			}
+			checkIns = append(checkIns, CheckIn{Fraction: percent / 100})
+		default:
+			lead, err := time.ParseDuration(field)
+			if err != nil || lead <= 0 {
+				return nil, fmt.Errorf("check-in %q should be a percentage, a time before expiry such as 2m, or adaptive", field)
+			}
+			checkIns = append(checkIns, CheckIn{Lead: lead})
+		}
+	}
+	return checkIns, nil
+}
+
+func checkInsString(checkIns []CheckIn) string {
+	fields := []string{}
+	for _, checkIn := range checkIns {
+		fields = append(fields, checkIn.String())
+	}
+	return strings.Join(fields, ",")
+}
+
+// A check-in worked out for a particular poll
+type CheckTime struct {
+	At      time.Time
+	Elapsed float64
+}
+
+// Work out when to check a poll which runs from createdAt to expiresAt, given
+// that it's now serverNow. Lead times longer than half the poll are checked
+// half way through instead. Check-ins which have already passed are dropped,
+// and if that leaves nothing the poll is checked half way through the time it
+// has left, so a short poll is never checked straight away or not at all.
+func checkTimes(createdAt, expiresAt, serverNow time.Time, checkIns []CheckIn) []CheckTime {
+	if !expiresAt.After(serverNow) {
+		return nil
+	}
+	if createdAt.IsZero() || createdAt.After(serverNow) {
+		createdAt = serverNow
+	}
+	duration := expiresAt.Sub(createdAt)
+	elapsed := func(at time.Time) float64 {
+		if duration <= 0 {
+			return 1
+		}
+		return float64(at.Sub(createdAt)) / float64(duration)
+	}
+
+	times := []CheckTime{}
+	seen := map[time.Time]bool{}
+	for _, checkIn := range checkIns {
+		var at time.Time
+		switch {
+		case checkIn.Adaptive:
+			// Not resolved from the archive, so there's nothing to go on
+			continue
+		case checkIn.Lead > 0:
+			if checkIn.Lead > duration/2 {
+				at = createdAt.Add(duration / 2)
+			} else {
+				at = expiresAt.Add(-checkIn.Lead)
+			}
+		default:
+			at = createdAt.Add(time.Duration(checkIn.Fraction * float64(duration)))
+		}
+		if !at.After(serverNow) || seen[at] {
+			continue
+		}
+		seen[at] = true
+		times = append(times, CheckTime{At: at, Elapsed: elapsed(at)})
+	}
+
+	if len(times) == 0 {
+		at := serverNow.Add(expiresAt.Sub(serverNow) / 2)
+		times = append(times, CheckTime{At: at, Elapsed: elapsed(at)})
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].At.Before(times[j].At) })
+	return times
+}
+
+// The share of a poll's votes which should be in before an adaptive check-in
+const adaptiveVoteShare = 0.9
+
+// How many archived polls with votes are needed before trusting the history
+const adaptiveMinPolls = 5
+
+// Work out an adaptive check-in from the poll snapshots in an archive. For
+// each poll, the vote counts at its check-ins give a rough curve of when
+// votes arrived; the check-in goes where the typical poll had most of its
+// votes. The snapshots only come from earlier check-ins, so the estimate is
+// only as fine as they were. Returns false if there isn't enough history.
+func adaptiveCheckIn(records []ArchiveRecord) (CheckIn, bool) {
+	snapshots := map[mastodon.ID][]ArchiveRecord{}
+	for _, record := range records {
+		if record.Kind == ArchivePoll && record.Poll != nil {
+			snapshots[record.Poll.ID] = append(snapshots[record.Poll.ID], record)
+		}
+	}
+
+	arrivals := []float64{}
+	for _, pollSnapshots := range snapshots {
+		sort.SliceStable(pollSnapshots, func(i, j int) bool {
+			return pollSnapshots[i].Elapsed < pollSnapshots[j].Elapsed
+		})
+		total := pollSnapshots[len(pollSnapshots)-1].Poll.VotesCount
+		if total == 0 {
+			continue
+		}
+
+		// Follow the curve until it reaches the share of the votes we want,
+		// assuming votes arrived steadily between snapshots
+		target := adaptiveVoteShare * float64(total)
+		previousElapsed, previousVotes := 0.0, 0.0
+		for _, snapshot := range pollSnapshots {
+			votes := float64(snapshot.Poll.VotesCount)
+			if votes >= target {
+				arrival := snapshot.Elapsed
+				if votes > previousVotes {
+					arrival = previousElapsed + (snapshot.Elapsed-previousElapsed)*(target-previousVotes)/(votes-previousVotes)
+				}
+				arrivals = append(arrivals, arrival)
+				break
+			}
+			previousElapsed, previousVotes = snapshot.Elapsed, votes
+		}
+	}
+
+	if len(arrivals) < adaptiveMinPolls {
+		return CheckIn{}, false
+	}
+
+	sort.Float64s(arrivals)
+	fraction := arrivals[len(arrivals)/2]
+	if fraction < 0.5 {
+		fraction = 0.5
+	}
+	if fraction > 0.99 {
+		fraction = 0.99
+	}
+	return CheckIn{Fraction: fraction}, true
+}
+
+// Replace adaptive check-ins with ones worked out from the archive. Adaptive
+// check-ins are dropped if there isn't enough history yet.
+func resolveCheckIns(checkIns []CheckIn, records []ArchiveRecord) []CheckIn {
+	resolved := []CheckIn{}
+	for _, checkIn := range checkIns {
+		if !checkIn.Adaptive {
+			resolved = append(resolved, checkIn)
+			continue
+		}
+		adaptive, ok := adaptiveCheckIn(records)
+		if !ok {
+			fmt.Println("⏰ Not enough poll history in the archive for an adaptive check-in yet")
+			continue
+		}
+		fmt.Println("⏰ Adaptive check-in at", adaptive)
+		resolved = append(resolved, adaptive)
+	}
+	if len(resolved) == 0 {
+		return defaultCheckIns
+	}
+	return resolved
+}
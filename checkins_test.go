@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestParseCheckIns(t *testing.T) {
+	valid := map[string]string{
+		"2m":                 "2m0s",
+		"50%, 90%,98%":       "50%,90%,98%",
+		"12.5%,adaptive,30s": "12.5%,adaptive,30s",
+	}
+	for spec, expected := range valid {
+		checkIns, err := parseCheckIns(spec)
+		if err != nil {
+			t.Errorf("parseCheckIns(%q) returned error %v", spec, err)
+			continue
+		}
+		if checkInsString(checkIns) != expected {
+			t.Errorf("parseCheckIns(%q) returned %s, want %s", spec, checkInsString(checkIns), expected)
+		}
+	}
+
+	invalid := []string{"", "50%,", "0%", "100%", "soon", "-2m", "lots%"}
+	for _, spec := range invalid {
+		if _, err := parseCheckIns(spec); err == nil {
+			t.Errorf("parseCheckIns(%q) returned no error", spec)
+		}
+	}
+}
+
+func TestCheckTimes(t *testing.T) {
+	start := schedulerStart
+	tests := []struct {
+		spec     string
+		duration time.Duration
+		seen     time.Duration // how long after the poll started the bot saw it
+		expected []time.Duration
+	}{
+		{"2m", 30 * time.Minute, 0, []time.Duration{28 * time.Minute}},
+		{"50%,90%,98%", 100 * time.Minute, 0, []time.Duration{50 * time.Minute, 90 * time.Minute, 98 * time.Minute}},
+		{"50%,90%,98%", 100 * time.Minute, 60 * time.Minute, []time.Duration{90 * time.Minute, 98 * time.Minute}},
+		{"2m", 3 * time.Minute, 0, []time.Duration{90 * time.Second}},
+		{"50%,2m", 4 * time.Minute, 0, []time.Duration{2 * time.Minute}},
+		{"50%", 10 * time.Minute, 8 * time.Minute, []time.Duration{9 * time.Minute}},
+	}
+
+	for _, test := range tests {
+		checkIns, _ := parseCheckIns(test.spec)
+		times := checkTimes(start, start.Add(test.duration), start.Add(test.seen), checkIns)
+
+		result := []time.Duration{}
+		for _, checkTime := range times {
+			result = append(result, checkTime.At.Sub(start))
+		}
+		if fmt.Sprint(result) != fmt.Sprint(test.expected) {
+			t.Errorf("checkTimes(%s) for a %v poll seen after %v returned %v, want %v", test.spec, test.duration, test.seen, result, test.expected)
+		}
+	}
+
+	// An expired poll has no check-ins
+	if times := checkTimes(start, start.Add(time.Minute), start.Add(2*time.Minute), defaultCheckIns); len(times) != 0 {
+		t.Errorf("checkTimes for an expired poll returned %v, want none", times)
+	}
+}
+
+// The archive records of a poll's check-ins, as elapsed fraction and votes
+func pollSnapshots(id string, snapshots ...float64) []ArchiveRecord {
+	records := []ArchiveRecord{}
+	for idx := 0; idx < len(snapshots); idx += 2 {
+		records = append(records, ArchiveRecord{
+			Kind:    ArchivePoll,
+			Poll:    &mastodon.Poll{ID: mastodon.ID(id), VotesCount: int64(snapshots[idx+1])},
+			Elapsed: snapshots[idx],
+		})
+	}
+	return records
+}
+
+func TestAdaptiveCheckIn(t *testing.T) {
+	// setup archive
+	records := []ArchiveRecord{}
+	for idx := 0; idx < adaptiveMinPolls; idx++ {
+		// Half the votes by half way, all of them by 90%
+		records = append(records, pollSnapshots(fmt.Sprint(idx), 0.5, 5, 0.9, 10, 0.98, 10)...)
+	}
+
+	// call function to test
+	checkIn, ok := adaptiveCheckIn(records)
+
+	// check result
+	if !ok || checkIn.Fraction < 0.819 || checkIn.Fraction > 0.821 {
+		t.Errorf("adaptiveCheckIn returned %v, %v, want 82%%", checkIn, ok)
+	}
+
+	if _, ok := adaptiveCheckIn(records[:3*(adaptiveMinPolls-1)]); ok {
+		t.Errorf("adaptiveCheckIn trusted %d polls of history", adaptiveMinPolls-1)
+	}
+
+	resolved := resolveCheckIns([]CheckIn{{Adaptive: true}}, nil)
+	if checkInsString(resolved) != checkInsString(defaultCheckIns) {
+		t.Errorf("resolveCheckIns without history returned %s, want the default %s", checkInsString(resolved), checkInsString(defaultCheckIns))
+	}
+}
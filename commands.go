@@ -0,0 +1,737 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+const usageText = `Usage: snakebot_admirer <command> [flags] [arguments]
+
+Commands:
+  run                     run the bot (the default when no command is given)
+  analyze <png|url>       parse a board image and print the grid, game state and ranked moves
+  render <state.json|->   draw a game state as text or PNG
+  simulate [state.json]   let the AI play a game on its own
+  replay <archive>        analyse the boards recorded in an archive file
+
+Run "snakebot_admirer <command> -h" to see the flags of a command.
+`
+
+// Entry point for the command line. Commands other than run write their
+// results to stdout, and their progress and errors to stderr, so that
+// scripts can read the results. Returns the process exit code.
+func runCommandLine(args []string, stdout, stderr io.Writer) int {
+	command := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	var err error
+	switch command {
+	case "run":
+		err = runCommand(args, stderr)
+	case "analyze":
+		err = analyzeCommand(args, stdout, stderr)
+	case "render":
+		err = renderCommand(args, stdout, stderr)
+	case "simulate":
+		err = simulateCommand(args, stdout, stderr)
+	case "replay":
+		err = replayCommand(args, stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usageText)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "Unknown command %q\n\n%s", command, usageText)
+		return 2
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// Output formats supported by the commands
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatPNG  = "png"
+)
+
+// Whether an argument is a position rather than a file or URL. A file wins,
+// so boards kept under a directory such as v1/ can still be analysed.
+func isPositionArgument(source string) bool {
+	if _, err := os.Stat(source); err == nil {
+		return false
+	}
+	return positionVersionPattern.MatchString(strings.Split(source, "/")[0])
+}
+
+func checkFormat(format string, allowed ...string) error {
+	for _, a := range allowed {
+		if format == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported format %q, expected one of %s", format, strings.Join(allowed, ", "))
+}
+
+func writeJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func runCommand(args []string, stderr io.Writer) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	archiveFile := flags.String("archive", "", "append every snakebot status seen to this archive file")
+	archiveMedia := flags.String("archive-media", "", "with -archive, also save the board images in this directory, for replay -media")
+	shadowFile := flags.String("shadow", "", "shadow mode: never post, edit or vote, log what would have been done to this file instead")
+	policySpec := flags.String("policy", defaultPolicyName, "when to vote: a policy name ("+policyNames()+") or a rule such as \"all(no-votes, default-deadly)\"")
+	accountsFile := flags.String("accounts", "", "JSON file listing the snake game accounts to watch and their board rules (default: snake_game@botsin.space)")
+	input := flags.String("input", InputStream, "how to hear about new statuses: stream, poll (read the watched accounts' statuses every -poll-interval) or both")
+	pollInterval := flags.Duration("poll-interval", time.Minute, "how often to read the watched accounts' statuses with -input poll or both")
+	threading := flags.String("threading", ThreadLink, "where analyses go: link (standalone posts linking to the board), reply (replies to the board) or game (one thread per game)")
+	visibility := flags.String("visibility", "", "visibility of the bot's posts: public or unlisted (default: the account's default)")
+	contentWarning := flags.String("content-warning", "", "content warning to put on the bot's posts")
+	boardStyleSpec := flags.String("board-styles", "", "how to draw the board as text in each place, e.g. \"post=ascii,log=unicode,alt=prose\" (styles: "+boardRendererNames()+")")
+	analysisImage := flags.Bool("image", true, "attach an image of the analysis, with alt text, to analysis posts")
+	analysisTemplate := flags.String("analysis-template", "", "text/template file for analysis posts (default: built in)")
+	voteTemplate := flags.String("vote-template", "", "text/template file for vote announcements (default: built in)")
+	puzzleTemplate := flags.String("puzzle-template", "", "text/template file for answers to puzzles (default: built in)")
+	puzzles := flags.Bool("puzzles", false, "answer mentions which have a board image or a position in them")
+	puzzleLimit := flags.Int("puzzle-limit", defaultPuzzleLimit, "how many puzzles one account can ask about in each -puzzle-window")
+	puzzleWindow := flags.Duration("puzzle-window", defaultPuzzleWindow, "the window -puzzle-limit applies to")
+	adminSpec := flags.String("admins", "", "comma separated accounts which can send the bot commands as direct messages, as the bot's instance shows them")
+	auditFile := flags.String("audit-log", "audit.jsonl", "append every admin command and its result to this file, with -admins")
+	subscribersFile := flags.String("subscribers", "", "keep the accounts subscribed to danger alerts in this file, which turns alerts on")
+	alertLead := flags.Duration("alert-lead", defaultAlertLead, "alert subscribers when the snake is in danger and its poll has this long left")
+	alertInterval := flags.Duration("alert-interval", defaultAlertInterval, "the least time between two alerts to the same subscriber")
+	checkInSpec := flags.String("checkins", checkInsString(defaultCheckIns), "when to check each poll: percentages of its duration, times before it expires, or adaptive, e.g. \"50%,90%,98%\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	policy, err := parseVotePolicy(*policySpec)
+	if err != nil {
+		return err
+	}
+
+	switch *input {
+	case InputStream, InputPoll, InputBoth:
+	default:
+		return fmt.Errorf("unsupported input mode %q, expected stream, poll or both", *input)
+	}
+	// Mentions and direct messages only arrive as notifications on the stream
+	if *input == InputPoll {
+		needed := []struct {
+			flag string
+			set  bool
+		}{{"-admins", *adminSpec != ""}, {"-subscribers", *subscribersFile != ""}, {"-puzzles", *puzzles}}
+		for _, need := range needed {
+			if need.set {
+				return fmt.Errorf("%s needs notifications, which only arrive with -input stream or both", need.flag)
+			}
+		}
+	}
+	if *pollInterval <= 0 {
+		return errors.New("-poll-interval must be positive")
+	}
+
+	boardStyles, err := parseBoardStyles(*boardStyleSpec)
+	if err != nil {
+		return err
+	}
+	posting := PostingConfig{Threading: *threading, Visibility: *visibility, ContentWarning: *contentWarning, AnalysisImage: *analysisImage, Boards: boardStyles}
+	if err := posting.validate(); err != nil {
+		return err
+	}
+
+	if *puzzleLimit <= 0 || *puzzleWindow <= 0 {
+		return errors.New("-puzzle-limit and -puzzle-window must be positive")
+	}
+	puzzleConfig := PuzzleConfig{Enabled: *puzzles, Limit: *puzzleLimit, Window: *puzzleWindow}
+
+	if *alertLead <= 0 || *alertInterval <= 0 {
+		return errors.New("-alert-lead and -alert-interval must be positive")
+	}
+	alerts := AlertConfig{Lead: *alertLead, Interval: *alertInterval}
+	if *subscribersFile != "" {
+		alerts.Subscribers, err = openSubscriberStore(*subscribersFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	composer, err := loadComposer(*analysisTemplate, *voteTemplate, *puzzleTemplate)
+	if err != nil {
+		return err
+	}
+
+	checkIns, err := parseCheckIns(*checkInSpec)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := watchedAccounts(*accountsFile)
+	if err != nil {
+		return err
+	}
+
+	if hasAdaptiveCheckIn(checkIns, accounts) {
+		if *archiveFile == "" {
+			return errors.New("adaptive check-ins learn from the archive, so they need -archive")
+		}
+		// Learn from the polls archived on earlier runs, if there are any
+		records, err := readArchive(*archiveFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		checkIns = resolveCheckIns(checkIns, records)
+		for _, account := range accounts {
+			if len(account.Rules.CheckIns) > 0 {
+				account.Rules.CheckIns = resolveCheckIns(account.Rules.CheckIns, records)
+			}
+		}
+	}
+
+	mastodonServer := os.Getenv("MASTODON_SERVER")
+	clientKey := os.Getenv("CLIENT_KEY")
+	clientSecret := os.Getenv("CLIENT_SECRET")
+	accessToken := os.Getenv("ACCESS_TOKEN")
+
+	client := mastodon.NewClient(&mastodon.Config{
+		Server:       mastodonServer,
+		ClientID:     clientKey,
+		ClientSecret: clientSecret,
+		AccessToken:  accessToken,
+	})
+
+	fmt.Println("Connected to Mastodon server")
+	services := mastodonServices(client)
+
+	config := BotConfig{Policy: policy, CheckIns: checkIns, Accounts: accounts, Posting: posting, Composer: composer, Puzzles: puzzleConfig, Alerts: alerts}
+	if *archiveFile != "" {
+		config.Archive, err = openArchiveWriter(*archiveFile, *archiveMedia, services.Clock)
+		if err != nil {
+			return err
+		}
+	}
+	for _, admin := range strings.Split(*adminSpec, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			config.Admins = append(config.Admins, admin)
+		}
+	}
+	if len(config.Admins) > 0 {
+		config.Audit, err = openAuditLog(*auditFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	poller := AccountPoller{Client: client, Accounts: accounts, Interval: *pollInterval, Clock: services.Clock}
+	services.Events = inputEvents(*input, services.Events, poller)
+	fmt.Println("📮 Listening for statuses with input mode", *input)
+	if *shadowFile != "" {
+		shadow, err := openShadowRecorder(*shadowFile, services.Clock)
+		if err != nil {
+			return err
+		}
+		services.Publisher = shadow
+		services.Editor = shadow
+		services.Media = shadow
+		services.Voter = shadow
+		fmt.Println("👻 Running in shadow mode, recording to", *shadowFile)
+	}
+
+	fmt.Println("🗳️ Voting policy:", policy)
+	fmt.Println("⏰ Poll check-ins:", checkInsString(checkIns))
+	fmt.Println("Threading analyses as", *threading)
+	if *puzzles {
+		fmt.Println("🧩 Answering puzzles, up to", *puzzleLimit, "per account every", *puzzleWindow)
+	}
+	if alerts.Subscribers != nil {
+		fmt.Println("🚨 Alerting subscribers", *alertLead, "before a poll closes when the snake is in danger, at most once every", *alertInterval)
+	}
+	for _, account := range accounts {
+		fmt.Println("👀 Watching", account.Acct)
+	}
+	for _, admin := range config.Admins {
+		fmt.Println("🔧 Taking commands from", admin)
+	}
+
+	return runBot(context.Background(), services, config)
+}
+
+func analyzeCommand(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	size := flags.String("size", "8x5", "board size in spaces, as WIDTHxHEIGHT")
+	altText := flags.String("alt", "", "ALT text of the image, used to find the board size instead of -size")
+	format := flags.String("format", FormatText, "output format: text or json")
+	dumpCells := flags.Bool("dump-cells", false, "write each board space to an image_grid_X_Y.png file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, FormatText, FormatJSON); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("analyze needs exactly one PNG file, URL or position")
+	}
+
+	// A position from one of the bot's posts is analysed as it is
+	if source := flags.Arg(0); isPositionArgument(source) {
+		game, err := decodePosition(source)
+		if err != nil {
+			return err
+		}
+		analysis, err := analyzeGameState(game, stderr)
+		if err != nil {
+			return err
+		}
+		return writeAnalysis(stdout, *format, analysis)
+	}
+
+	dimensions := *size
+	if *altText != "" {
+		dimensions = *altText
+	}
+	boardWidth, boardHeight, err := extractBoardDimensions(dimensions)
+	if err != nil {
+		return err
+	}
+
+	source := flags.Arg(0)
+	var imageData image.Image
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		imageData, err = downloadImage(source)
+	} else {
+		imageData, err = loadImageFromDisk(source)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *dumpCells {
+		croppedImageData, err := autocropImage(imageData)
+		if err != nil {
+			return err
+		}
+		imageGrid, err := imageToGridImages(croppedImageData, boardWidth, boardHeight)
+		if err != nil {
+			return err
+		}
+		dumpImageGridToFiles(imageGrid)
+	}
+
+	analysis, err := analyzeBoardImage(imageData, boardWidth, boardHeight, defaultPalette, stderr)
+	if err != nil {
+		return err
+	}
+
+	return writeAnalysis(stdout, *format, analysis)
+}
+
+func writeAnalysis(w io.Writer, format string, analysis Analysis) error {
+	if format == FormatJSON {
+		return writeJSON(w, analysis)
+	}
+	writeAnalysisText(w, analysis)
+	return nil
+}
+
+func writeAnalysisText(w io.Writer, analysis Analysis) {
+	game := analysis.GameState
+	fmt.Fprintf(w, "Board: %dx%d\n", game.BoardWidth, game.BoardHeight)
+	fmt.Fprintln(w, analysis.Grid)
+	fmt.Fprintf(w, "Snake: head at %v heading %s, %d segments\n", snakeHead(game), game.Direction, len(game.SnakeShape))
+	fmt.Fprintf(w, "Food: %v\n", game.Food)
+	fmt.Fprintln(w, "Moves:")
+	for i, move := range analysis.Moves {
+		deadly := ""
+		if move.Deadly {
+			deadly = "  deadly"
+		}
+		fmt.Fprintf(w, "  %d. %-5s  score %d%s\n", i+1, move.Move, move.Score, deadly)
+	}
+	fmt.Fprintln(w, "Best move:", analysis.BestMove)
+	fmt.Fprintln(w, "Must turn:", analysis.MustTurn)
+	if analysis.Position != "" {
+		fmt.Fprintln(w, "Position:", analysis.Position)
+	}
+}
+
+func readGameStateFile(filename string) (GameState, error) {
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return GameState{}, err
+	}
+
+	// Anything but JSON should be a board drawn as text
+	if !strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		_, game, err := parseBoardDrawing(string(data))
+		if err != nil {
+			return GameState{}, fmt.Errorf("failed to read board drawing: %v", err)
+		}
+		return game, nil
+	}
+
+	// Accept the output of analyze -format json as well as a bare game state
+	var wrapped struct {
+		GameState *GameState `json:"game_state"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.GameState != nil {
+		return *wrapped.GameState, wrapped.GameState.Validate()
+	}
+
+	var game GameState
+	if err := json.Unmarshal(data, &game); err != nil {
+		return GameState{}, fmt.Errorf("failed to parse game state: %v", err)
+	}
+	return game, game.Validate()
+}
+
+func renderCommand(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", FormatText, "output format: text, json or png")
+	outputFile := flags.String("o", "", "write the output to this file instead of stdout")
+	cellSize := flags.Int("cell", 40, "size of a board space in pixels, for png output")
+	style := flags.String("style", "unicode", "how to draw the board as text: "+boardRendererNames())
+	withAnalysis := flags.Bool("analysis", false, "add the AI's analysis as the bot posts it: drawn over the board for png, as alt text for text")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, FormatText, FormatJSON, FormatPNG); err != nil {
+		return err
+	}
+	if *cellSize <= 0 {
+		flags.Usage()
+		return fmt.Errorf("-cell must be a positive number of pixels, not %d", *cellSize)
+	}
+	if flags.NArg() != 1 {
+		return errors.New("render needs exactly one game state JSON file, or - for stdin")
+	}
+
+	renderer, err := parseBoardRenderer(*style)
+	if err != nil {
+		return err
+	}
+
+	game, err := readGameStateFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	out := stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	moves := evaluateMoves(game)
+	bestMove := rankMoves(game)[0].Move
+
+	switch *format {
+	case FormatPNG:
+		if *withAnalysis {
+			img, err := renderAnalysisImage(game, moves, bestMove, *cellSize)
+			if err != nil {
+				return err
+			}
+			return png.Encode(out, img)
+		}
+		img, err := renderGameStateImage(game, *cellSize)
+		if err != nil {
+			return err
+		}
+		return png.Encode(out, img)
+	default:
+		grid, err := renderer.RenderBoard(game)
+		if err != nil {
+			return err
+		}
+		if *format == FormatJSON {
+			return writeJSON(out, struct {
+				Grid      string    `json:"grid"`
+				GameState GameState `json:"game_state"`
+			}{grid, game})
+		}
+		if _, err := fmt.Fprintln(out, grid); err != nil {
+			return err
+		}
+		if *withAnalysis {
+			_, err = fmt.Fprintln(out, analysisAltText(game, moves, bestMove, ProseRenderer{}))
+		}
+		return err
+	}
+}
+
+// One turn of a simulated game
+type SimulatedTurn struct {
+	Turn      int              `json:"turn"`
+	Move      string           `json:"move"`
+	Moves     []MoveEvaluation `json:"moves"`
+	AteFood   bool             `json:"ate_food"`
+	Died      bool             `json:"died"`
+	GameState GameState        `json:"game_state"`
+}
+
+func simulateCommand(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	turns := flags.Int("turns", 50, "maximum number of turns to play")
+	seed := flags.Int64("seed", 0, "random seed for food placement (0 picks one from the clock)")
+	size := flags.String("size", "8x5", "board size for a new game, as WIDTHxHEIGHT")
+	format := flags.String("format", FormatText, "output format: text or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, FormatText, FormatJSON); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return errors.New("simulate takes at most one game state JSON file")
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+
+	var game GameState
+	if flags.NArg() == 1 {
+		var err error
+		game, err = readGameStateFile(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+	} else {
+		boardWidth, boardHeight, err := extractBoardDimensions(*size)
+		if err != nil {
+			return err
+		}
+		game = newGameState(boardWidth, boardHeight, rng)
+	}
+
+	history := []SimulatedTurn{}
+	for turn := 1; turn <= *turns; turn++ {
+		move, _ := determineNextMove(game)
+		if move == "" {
+			break
+		}
+
+		next, ateFood, died := simulateStep(game, move, rng)
+		history = append(history, SimulatedTurn{
+			Turn:      turn,
+			Move:      move,
+			Moves:     rankMoves(game),
+			AteFood:   ateFood,
+			Died:      died,
+			GameState: next,
+		})
+		if died {
+			break
+		}
+		game = next
+	}
+
+	if *format == FormatJSON {
+		return writeJSON(stdout, struct {
+			Seed  int64           `json:"seed"`
+			Turns []SimulatedTurn `json:"turns"`
+		}{*seed, history})
+	}
+
+	fmt.Fprintln(stdout, "Seed:", *seed)
+	for _, turn := range history {
+		fmt.Fprintf(stdout, "Turn %d: move %s", turn.Turn, turn.Move)
+		if turn.AteFood {
+			fmt.Fprint(stdout, ", ate the food")
+		}
+		if turn.Died {
+			fmt.Fprintln(stdout, ", and died")
+			break
+		}
+		fmt.Fprintln(stdout)
+		board, err := UnicodeRenderer{}.RenderBoard(turn.GameState)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, board)
+	}
+	return nil
+}
+
+// What the replay command found in one archived status
+type ReplayEntry struct {
+	Time     time.Time      `json:"time"`
+	StatusID mastodon.ID    `json:"status_id"`
+	URL      string         `json:"url"`
+	Poll     *mastodon.Poll `json:"poll,omitempty"`
+	Analysis *Analysis      `json:"analysis,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func replayCommand(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", FormatText, "output format: text or json")
+	accountsFile := flags.String("accounts", "", "the accounts file the archive was recorded with, for each account's board rules")
+	mediaDir := flags.String("media", "", "the directory the board images were saved in with run -archive-media; images which aren't there are downloaded again")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, FormatText, FormatJSON); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("replay needs exactly one archive file")
+	}
+
+	accounts, err := watchedAccounts(*accountsFile)
+	if err != nil {
+		return err
+	}
+
+	records, err := readArchive(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	entries := []ReplayEntry{}
+	for _, record := range records {
+		if record.Kind != ArchiveStatus || record.Status == nil {
+			continue
+		}
+		status := record.Status
+		entry := ReplayEntry{Time: record.Time, StatusID: status.ID, URL: status.URL}
+
+		if status.Poll != nil {
+			entry.Poll = status.Poll
+		} else if len(status.MediaAttachments) > 0 && status.MediaAttachments[0].Type == "image" {
+			rules := defaultAccountRules()
+			if account := findWatchedAccount(accounts, status.Account.Acct); account != nil {
+				rules = account.Rules
+			}
+			imageData, err := archivedImage(*mediaDir, status.MediaAttachments[0])
+			if err != nil {
+				entry.Error = fmt.Sprintf("failed to load image: %v", err)
+			} else if analysis, err := analyzeAttachmentImage(imageData, status.MediaAttachments[0], rules, stderr); err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Analysis = &analysis
+			}
+		} else {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if *format == FormatJSON {
+		return writeJSON(stdout, entries)
+	}
+
+	for _, entry := range entries {
+		fmt.Fprintf(stdout, "%s %s %s\n", entry.Time.Format(time.RFC3339), entry.StatusID, entry.URL)
+		if entry.Error != "" {
+			fmt.Fprintln(stdout, "Error:", entry.Error)
+		}
+		if entry.Poll != nil {
+			fmt.Fprintf(stdout, "Poll expiring %s with %d votes:\n", entry.Poll.ExpiresAt.Format(time.RFC3339), entry.Poll.VotesCount)
+			for _, option := range entry.Poll.Options {
+				fmt.Fprintf(stdout, "  %-20s %d\n", option.Title, option.VotesCount)
+			}
+		}
+		if entry.Analysis != nil {
+			writeAnalysisText(stdout, *entry.Analysis)
+		}
+		fmt.Fprintln(stdout)
+	}
+	return nil
+}
+
+// The event source for an input mode
+func inputEvents(input string, stream EventSource, poller AccountPoller) EventSource {
+	switch input {
+	case InputPoll:
+		return poller
+	case InputBoth:
+		return MergedEvents{Sources: []EventSource{stream, poller}}
+	default:
+		return stream
+	}
+}
+
+// The accounts listed in an accounts file, or the default one if there's no
+// file
+func watchedAccounts(filename string) ([]*WatchedAccount, error) {
+	if filename == "" {
+		return defaultWatchedAccounts(), nil
+	}
+	return loadAccountsFile(filename)
+}
+
+func hasAdaptiveCheckIn(checkIns []CheckIn, accounts []*WatchedAccount) bool {
+	for _, checkIn := range checkIns {
+		if checkIn.Adaptive {
+			return true
+		}
+	}
+	for _, account := range accounts {
+		if hasAdaptiveCheckIn(account.Rules.CheckIns, nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// Download and analyse a board image attached to a status
+func analyzeAttachment(attachment mastodon.Attachment, rules AccountRules, progress io.Writer) (Analysis, error) {
+	imageData, err := downloadImage(attachment.URL)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("failed to download image: %v", err)
+	}
+	return analyzeAttachmentImage(imageData, attachment, rules, progress)
+}
+
+// Analyse the image of an attachment, which has already been fetched
+func analyzeAttachmentImage(imageData image.Image, attachment mastodon.Attachment, rules AccountRules, progress io.Writer) (Analysis, error) {
+	boardWidth, boardHeight, err := rules.boardDimensions(attachment.Description)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	return analyzeBoardImage(imageData, boardWidth, boardHeight, rules.Palette, progress)
+}
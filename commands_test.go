@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Run the command line and return what it wrote to stdout, failing the test
+// if the command failed
+func runTestCommand(t *testing.T, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	if code := runCommandLine(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("%v exited with %d: %s", args, code, stderr.String())
+	}
+	return stdout.String()
+}
+
+// Save a rendered board image, as snakebot would post it
+func writeBoardImage(t *testing.T, filename string, game GameState) {
+	t.Helper()
+	img, err := renderGameStateImage(game, 40)
+	if err != nil {
+		t.Fatalf("renderGameStateImage returned error %v", err)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeGameStateFile(t *testing.T, filename string, game GameState) {
+	t.Helper()
+	data, err := json.Marshal(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnalyzeCommand(t *testing.T) {
+	// setup
+	boardFile := filepath.Join(t.TempDir(), "board.png")
+	writeBoardImage(t, boardFile, doomedGame)
+
+	// call function to test
+	text := runTestCommand(t, "analyze", boardFile)
+	jsonText := runTestCommand(t, "analyze", "-format", "json", boardFile)
+
+	// check result: the pipeline's progress isn't mixed in with the result
+	if !strings.HasPrefix(text, "Board: 8x5\n") || !strings.Contains(text, "Best move: up\n") || !strings.Contains(text, "Must turn: true\n") {
+		t.Errorf("analyze printed %q, want the board, best move up and must turn", text)
+	}
+	var analysis Analysis
+	if err := json.Unmarshal([]byte(jsonText), &analysis); err != nil {
+		t.Fatalf("analyze -format json printed %q which isn't JSON: %v", jsonText, err)
+	}
+	if !equalGameStates(analysis.GameState, doomedGame) || analysis.BestMove != "up" {
+		t.Errorf("analyze -format json returned %v moving %s, want %v moving up", analysis.GameState, analysis.BestMove, doomedGame)
+	}
+}
+
+func TestAnalyzeCommandReadsPositions(t *testing.T) {
+	// setup
+	position, err := encodePosition(doomedGame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// call function to test
+	text := runTestCommand(t, "analyze", position)
+
+	// check result
+	if !strings.Contains(text, "Best move: up\n") || !strings.Contains(text, "Position: "+position+"\n") {
+		t.Errorf("analyze %s printed %q, want best move up and the position", position, text)
+	}
+}
+
+func TestRenderCommand(t *testing.T) {
+	// setup
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	writeGameStateFile(t, stateFile, safeGame)
+	wantGrid, err := ASCIIRenderer{}.RenderBoard(safeGame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// call function to test
+	text := runTestCommand(t, "render", "-style", "ascii", stateFile)
+	jsonText := runTestCommand(t, "render", "-format", "json", stateFile)
+
+	// check result
+	if text != wantGrid+"\n" {
+		t.Errorf("render printed %q, want %q", text, wantGrid+"\n")
+	}
+	var rendered struct {
+		Grid      string    `json:"grid"`
+		GameState GameState `json:"game_state"`
+	}
+	if err := json.Unmarshal([]byte(jsonText), &rendered); err != nil {
+		t.Fatalf("render -format json printed %q which isn't JSON: %v", jsonText, err)
+	}
+	if !equalGameStates(rendered.GameState, safeGame) || !strings.HasPrefix(rendered.Grid, "┌") {
+		t.Errorf("render -format json returned %+v, want the unicode board of %v", rendered, safeGame)
+	}
+}
+
+func TestSimulateCommand(t *testing.T) {
+	// setup
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	writeGameStateFile(t, stateFile, safeGame)
+
+	// call function to test
+	text := runTestCommand(t, "simulate", "-seed", "7", "-turns", "3", stateFile)
+	jsonText := runTestCommand(t, "simulate", "-seed", "7", "-turns", "3", "-format", "json", stateFile)
+
+	// check result: the snake has room for three turns
+	if !strings.HasPrefix(text, "Seed: 7\nTurn 1: move right\n") || !strings.Contains(text, "Turn 3: move") {
+		t.Errorf("simulate printed %q, want three turns from seed 7", text)
+	}
+	var simulated struct {
+		Seed  int64           `json:"seed"`
+		Turns []SimulatedTurn `json:"turns"`
+	}
+	if err := json.Unmarshal([]byte(jsonText), &simulated); err != nil {
+		t.Fatalf("simulate -format json printed %q which isn't JSON: %v", jsonText, err)
+	}
+	if simulated.Seed != 7 || len(simulated.Turns) != 3 || simulated.Turns[0].Move != "right" {
+		t.Errorf("simulate -format json returned %+v, want three turns from seed 7 starting right", simulated)
+	}
+}
+
+func TestReplayCommandUsesSavedMedia(t *testing.T) {
+	// setup: an archive whose media has gone from the server, one board of
+	// which was saved
+	dir := t.TempDir()
+	mediaDir := filepath.Join(dir, "media")
+	if err := os.Mkdir(mediaDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	goneURL := "http://127.0.0.1:1/media/"
+	saved := mastodon.Attachment{ID: "11", Type: "image", URL: goneURL + "saved.png", Description: "A 8x5 snake board"}
+	missing := mastodon.Attachment{ID: "12", Type: "image", URL: goneURL + "missing.png", Description: "A 8x5 snake board"}
+	writeBoardImage(t, archivedMediaFile(mediaDir, saved), doomedGame)
+
+	archiveFile := filepath.Join(dir, "archive.jsonl")
+	archive, err := openArchiveWriter(archiveFile, "", newFakeClock(schedulerStart))
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := []*mastodon.Status{
+		{ID: "21", Account: fakeSnakebotAccount, MediaAttachments: []mastodon.Attachment{saved}},
+		{ID: "22", Account: fakeSnakebotAccount, Poll: &mastodon.Poll{ID: "31", ExpiresAt: time.Now(), Options: []mastodon.PollOption{{Title: "Move up", VotesCount: 2}}}},
+		{ID: "23", Account: fakeSnakebotAccount, MediaAttachments: []mastodon.Attachment{missing}},
+	}
+	for _, status := range statuses {
+		if err := archive.writeStatus(status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := readArchive(archiveFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !records[0].Time.Equal(schedulerStart) {
+		t.Errorf("archive has the first status at %v, want the clock's time %v", records[0].Time, schedulerStart)
+	}
+
+	// call function to test
+	jsonText := runTestCommand(t, "replay", "-format", "json", "-media", mediaDir, archiveFile)
+	text := runTestCommand(t, "replay", "-media", mediaDir, archiveFile)
+
+	// check result
+	var entries []ReplayEntry
+	if err := json.Unmarshal([]byte(jsonText), &entries); err != nil {
+		t.Fatalf("replay -format json printed %q which isn't JSON: %v", jsonText, err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("replay returned %d entries, want 3", len(entries))
+	}
+	if entries[0].Analysis == nil || !equalGameStates(entries[0].Analysis.GameState, doomedGame) {
+		t.Errorf("replay analysed the saved board as %+v, want %v", entries[0], doomedGame)
+	}
+	if entries[1].Poll == nil || entries[1].Poll.ID != "31" {
+		t.Errorf("replay returned %+v for the poll, want poll 31", entries[1])
+	}
+	if entries[2].Analysis != nil || entries[2].Error == "" {
+		t.Errorf("replay returned %+v for the board without media, want an error", entries[2])
+	}
+	if !strings.Contains(text, "Best move: up\n") || !strings.Contains(text, "Move up") {
+		t.Errorf("replay printed %q, want the saved board's analysis and the poll", text)
+	}
+}
+
+func TestRenderCommandExplainsBadDrawings(t *testing.T) {
+	// setup: a drawing with two heads
+	drawingFile := filepath.Join(t.TempDir(), "board.txt")
+	if err := os.WriteFile(drawingFile, []byte("@.>-o\n..<-o\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// call function to test
+	var stdout, stderr bytes.Buffer
+	code := runCommandLine([]string{"render", drawingFile}, &stdout, &stderr)
+
+	// check result: the problem with the drawing, not with JSON
+	if code == 0 {
+		t.Fatalf("render of a bad drawing succeeded, printing %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "2 snake heads") {
+		t.Errorf("render printed %q, want the problem with the drawing", stderr.String())
+	}
+}
+
+func TestAnalyzeCommandPrefersFilesToPositions(t *testing.T) {
+	// setup: a board image under a directory which looks like a version
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeBoardImage(t, filepath.Join(dir, "v1", "board.png"), doomedGame)
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workDir)
+
+	// call function to test
+	text := runTestCommand(t, "analyze", "v1/board.png")
+
+	// check result
+	if !strings.Contains(text, "Best move: up\n") {
+		t.Errorf("analyze v1/board.png printed %q, want the board's analysis", text)
+	}
+}
+
+func TestRenderCommandRejectsBadCellSizes(t *testing.T) {
+	// setup
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	writeGameStateFile(t, stateFile, safeGame)
+
+	for _, cell := range []string{"0", "-3"} {
+		// call function to test
+		var stdout, stderr bytes.Buffer
+		code := runCommandLine([]string{"render", "-format", "png", "-cell", cell, stateFile}, &stdout, &stderr)
+
+		// check result
+		if code == 0 || !strings.Contains(stderr.String(), "-cell must be a positive") {
+			t.Errorf("render -cell %s exited with %d printing %q, want an error about the cell size", cell, code, stderr.String())
+		}
+	}
+}
+
+func TestRunCommandRefusesNotificationsWithoutTheStream(t *testing.T) {
+	for _, flagArgs := range [][]string{{"-admins", "alice"}, {"-subscribers", "subscribers.json"}, {"-puzzles"}} {
+		// call function to test
+		var stdout, stderr bytes.Buffer
+		code := runCommandLine(append([]string{"run", "-input", "poll"}, flagArgs...), &stdout, &stderr)
+
+		// check result
+		if code == 0 || !strings.Contains(stderr.String(), flagArgs[0]+" needs notifications") {
+			t.Errorf("run -input poll %v exited with %d printing %q, want an error about notifications", flagArgs, code, stderr.String())
+		}
+	}
+}
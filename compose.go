@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// The character limit on Mastodon unless the instance says otherwise
+const defaultMaxCharacters = 500
+
+// Mastodon counts every link as this many characters, however long it is
+const linkCharacters = 23
+
+// What the post templates can use
+type PostFields struct {
+	// The board as text. Empty when it's been left out to save space.
+	Board string
+	// The move the bot recommends or votes for
+	Move string
+	// How the AI scored each move
+	Scores []MoveEvaluation
+	// Whether the snake is headed for disaster if it doesn't turn
+	Danger bool
+	// Snakebot's status
+	Link string
+	// The board in position notation, so the analysis can be reproduced
+	Position string
+	// Who asked about a puzzle, as a mention
+	Asker string
+	// Why the bot is voting, for vote announcements
+	Reason string
+	// The move the bot would rather have voted for, if the poll didn't
+	// offer it
+	PreferredMove string
+	// Whether to keep the wording short to fit the character limit
+	Short bool
+}
+
+// The analysis post. With the board left out it's much shorter, and the
+// short form is shorter still.
+const defaultAnalysisTemplate = `{{if .Short -}}
+Snakebot's latest: {{.Link}}
+
+{{if .Danger}}Danger ahead! {{end}}I think the snake should move {{.Move}}.
+{{- if .Position}} {{.Position}}{{end}}
+{{- else -}}
+I am watching snakebot slithering. The most recent update I saw was {{.Link}}
+
+{{if .Board}}This is what I see, in text form:
+
+{{.Board}}
+
+{{end}}{{if .Danger}}It looks like the snake is headed for disaster if it doesn't turn!
+
+{{end}}I'm not very smart, but I think the snake should move {{.Move}} next.
+{{- if .Position}}
+
+Position: {{.Position}}{{end}}
+{{- end}}`
+
+// The post announcing a vote
+const defaultVoteTemplate = `{{if .Short -}}
+{{sentence .Reason}}! Voting to move {{.Move}}.
+{{- else -}}
+{{sentence .Reason}}! I usually don't vote, but this time, I'm voting to move {{.Move}}.
+{{- if .PreferredMove}} I'd rather move {{.PreferredMove}}, but that isn't one of the options.{{end}}
+{{- end}}`
+
+// The reply to someone who asked about a puzzle. Reason says what was wrong
+// with a puzzle the bot couldn't read.
+const defaultPuzzleTemplate = `{{.Asker}} {{if .Reason -}}
+Sorry, I couldn't read that board: {{.Reason}}
+{{- else if .Short -}}
+{{if .Danger}}Danger ahead! {{end}}I'd move {{.Move}}.{{if .Position}} {{.Position}}{{end}}
+{{- else -}}
+{{if .Board}}Here's the board as I see it:
+
+{{.Board}}
+
+{{end}}How I rank the moves:
+{{- range .Scores}}
+{{.Move}}: {{.Score}}{{if .Deadly}}, deadly: the snake would {{.Danger}}{{end}}
+{{- end}}
+
+{{if .Danger}}The snake is headed for disaster if it doesn't turn! {{end}}I'd move {{.Move}}.
+{{- if .Position}}
+
+Position: {{.Position}}{{end}}
+{{- end}}`
+
+var templateFuncs = template.FuncMap{
+	"sentence": sentence,
+}
+
+// Writes the bot's posts from templates, keeping them within the
+// instance's character limit
+type Composer struct {
+	Analysis      *template.Template
+	Vote          *template.Template
+	Puzzle        *template.Template
+	MaxCharacters int
+
+	// The content warning on the bot's posts, which Mastodon counts
+	// towards the limit along with the post
+	ContentWarning string
+}
+
+func defaultComposer() *Composer {
+	return &Composer{
+		Analysis:      template.Must(template.New("analysis").Funcs(templateFuncs).Parse(defaultAnalysisTemplate)),
+		Vote:          template.Must(template.New("vote").Funcs(templateFuncs).Parse(defaultVoteTemplate)),
+		Puzzle:        template.Must(template.New("puzzle").Funcs(templateFuncs).Parse(defaultPuzzleTemplate)),
+		MaxCharacters: defaultMaxCharacters,
+	}
+}
+
+// The default composer with the templates in these files, where given
+func loadComposer(analysisFile, voteFile, puzzleFile string) (*Composer, error) {
+	composer := defaultComposer()
+	var err error
+	if analysisFile != "" {
+		if composer.Analysis, err = loadPostTemplate("analysis", analysisFile); err != nil {
+			return nil, err
+		}
+	}
+	if voteFile != "" {
+		if composer.Vote, err = loadPostTemplate("vote", voteFile); err != nil {
+			return nil, err
+		}
+	}
+	if puzzleFile != "" {
+		if composer.Puzzle, err = loadPostTemplate("puzzle", puzzleFile); err != nil {
+			return nil, err
+		}
+	}
+	return composer, nil
+}
+
+func loadPostTemplate(name, filename string) (*template.Template, error) {
+	text, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+
+	// Catch references to fields that don't exist now rather than on the
+	// first post
+	if _, err := executePostTemplate(tmpl, PostFields{Board: "#", Move: "up", Link: "https://example.com", Position: "v1/8x5/H3l2d/H1/r", Asker: "@someone", Reason: "test"}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func executePostTemplate(tmpl *template.Template, fields PostFields) (string, error) {
+	var text strings.Builder
+	if err := tmpl.Execute(&text, fields); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+func (c *Composer) composeAnalysis(fields PostFields) (string, error) {
+	return c.compose(c.Analysis, fields)
+}
+
+func (c *Composer) composeVote(fields PostFields) (string, error) {
+	return c.compose(c.Vote, fields)
+}
+
+func (c *Composer) composePuzzle(fields PostFields) (string, error) {
+	return c.compose(c.Puzzle, fields)
+}
+
+// Fill in a template, dropping the board and then shortening the wording
+// until the post fits. If even that's too long, the post is cut off.
+func (c *Composer) compose(tmpl *template.Template, fields PostFields) (string, error) {
+	attempts := []PostFields{fields}
+	if fields.Board != "" {
+		withoutBoard := fields
+		withoutBoard.Board = ""
+		attempts = append(attempts, withoutBoard)
+	}
+	short := fields
+	short.Board = ""
+	short.Short = true
+	attempts = append(attempts, short)
+
+	maxCharacters := c.MaxCharacters
+	if maxCharacters > 0 {
+		maxCharacters -= statusLength(strings.TrimSpace(c.ContentWarning))
+		if maxCharacters <= 0 {
+			return "", fmt.Errorf("the content warning leaves no room for a post in %d characters", c.MaxCharacters)
+		}
+	}
+
+	status := ""
+	for idx, attempt := range attempts {
+		var err error
+		status, err = executePostTemplate(tmpl, attempt)
+		if err != nil {
+			return "", err
+		}
+		if maxCharacters <= 0 || statusLength(status) <= maxCharacters {
+			if idx > 0 {
+				fmt.Println("Shortened a post to fit in", maxCharacters, "characters")
+			}
+			return status, nil
+		}
+	}
+
+	fmt.Println("A post is too long for", maxCharacters, "characters even when shortened, so cutting it off")
+	return truncateStatus(status, maxCharacters), nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// How long Mastodon thinks a status is
+func statusLength(status string) int {
+	links := linkPattern.FindAllString(status, -1)
+	length := utf8.RuneCountInString(linkPattern.ReplaceAllString(status, ""))
+	return length + len(links)*linkCharacters
+}
+
+// Cut a status off with an ellipsis so that it fits
+func truncateStatus(status string, maxCharacters int) string {
+	runes := []rune(status)
+	for len(runes) > 0 && statusLength(string(runes)+"…") > maxCharacters {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "…"
+}
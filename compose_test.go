@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatusLength(t *testing.T) {
+	// setup
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{"", 0},
+		{"move up", 7},
+		{"┌──┐", 4},
+		{"see https://botsin.space/@snake_game/109876543210987654 now", 4 + linkCharacters + 4},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got := statusLength(test.status)
+
+		// check result
+		if got != test.want {
+			t.Errorf("statusLength(%q) returned %d, want %d", test.status, got, test.want)
+		}
+	}
+}
+
+func TestComposerShortensPostsToFit(t *testing.T) {
+	// setup
+	fields := PostFields{
+		Board:    strings.Repeat("│        │\n", 20),
+		Move:     "up",
+		Danger:   true,
+		Link:     "https://botsin.space/@snake_game/1",
+		Position: "v1/8x5/H3l2d/H1/r",
+	}
+	full, err := executePostTemplate(defaultComposer().Analysis, fields)
+	if err != nil {
+		t.Fatalf("executePostTemplate returned error %v", err)
+	}
+
+	tests := []struct {
+		maxCharacters int
+		wantBoard     bool
+		wantDanger    string
+	}{
+		{1000, true, "headed for disaster"},
+		{300, false, "headed for disaster"},
+		{120, false, "Danger ahead!"},
+	}
+
+	for _, test := range tests {
+		composer := defaultComposer()
+		composer.MaxCharacters = test.maxCharacters
+
+		// call function to test
+		status, err := composer.composeAnalysis(fields)
+
+		// check result
+		if err != nil {
+			t.Errorf("composeAnalysis with %d characters returned error %v", test.maxCharacters, err)
+			continue
+		}
+		if length := statusLength(status); length > test.maxCharacters {
+			t.Errorf("composeAnalysis with %d characters returned a post %d characters long", test.maxCharacters, length)
+		}
+		if test.wantBoard && status != full {
+			t.Errorf("composeAnalysis with %d characters returned %q, want %q", test.maxCharacters, status, full)
+		}
+		if !test.wantBoard && strings.Contains(status, "│") {
+			t.Errorf("composeAnalysis with %d characters returned %q, want the board left out", test.maxCharacters, status)
+		}
+		if !strings.Contains(status, test.wantDanger) {
+			t.Errorf("composeAnalysis with %d characters returned %q, want it to contain %q", test.maxCharacters, status, test.wantDanger)
+		}
+		if !strings.Contains(status, fields.Position) {
+			t.Errorf("composeAnalysis with %d characters returned %q, want the position", test.maxCharacters, status)
+		}
+	}
+}
+
+func TestComposerCutsOffPostsThatStillDontFit(t *testing.T) {
+	// setup
+	composer := defaultComposer()
+	composer.MaxCharacters = 20
+
+	// call function to test
+	status, err := composer.composeVote(PostFields{Move: "left", Reason: "the snake is about to hit the wall"})
+
+	// check result
+	if err != nil {
+		t.Fatalf("composeVote returned error %v", err)
+	}
+	if statusLength(status) > 20 || !strings.HasSuffix(status, "…") {
+		t.Errorf("composeVote returned %q, want it cut off at 20 characters", status)
+	}
+}
+
+func TestComposerLeavesRoomForTheContentWarning(t *testing.T) {
+	// setup
+	composer := defaultComposer()
+	composer.MaxCharacters = 40
+	composer.ContentWarning = "Snake spoilers"
+
+	// call function to test
+	status, err := composer.composeVote(PostFields{Move: "left", Reason: "the snake is about to hit the wall"})
+
+	// check result: Mastodon counts the content warning with the post
+	if err != nil {
+		t.Fatalf("composeVote returned error %v", err)
+	}
+	if length := statusLength(status) + statusLength(composer.ContentWarning); length > 40 {
+		t.Errorf("composeVote returned %q, which is %d characters with the content warning, want at most 40", status, length)
+	}
+}
+
+func TestComposerRejectsContentWarningsWhichFillThePost(t *testing.T) {
+	// setup
+	composer := defaultComposer()
+	composer.MaxCharacters = 10
+	composer.ContentWarning = "Snake spoilers"
+
+	// call function to test
+	status, err := composer.composeVote(PostFields{Move: "left"})
+
+	// check result
+	if err == nil {
+		t.Errorf("composeVote returned %q, want an error for a content warning longer than the limit", status)
+	}
+}
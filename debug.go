@@ -0,0 +1,6 @@
+//go:build debug
+
+package main
+
+// Built with -tags debug, game states are checked at every step
+const debugChecks = true
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Where the bot hears about new statuses
+const (
+	InputStream = "stream"
+	InputPoll   = "poll"
+	InputBoth   = "both"
+)
+
+// How many status IDs to remember when deduplicating
+const seenStatusesSize = 1000
+
+// Remembers the IDs of recent statuses, forgetting the oldest first. Safe
+// to use from several goroutines.
+type SeenStatuses struct {
+	mutex sync.Mutex
+	size  int
+	ids   map[mastodon.ID]bool
+	order []mastodon.ID
+}
+
+func newSeenStatuses(size int) *SeenStatuses {
+	return &SeenStatuses{size: size, ids: make(map[mastodon.ID]bool)}
+}
+
+// Remember a status. Returns false if it had already been seen.
+func (s *SeenStatuses) add(id mastodon.ID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ids[id] {
+		return false
+	}
+	s.ids[id] = true
+	s.order = append(s.order, id)
+	if len(s.order) > s.size {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// Reads accounts and their statuses over the REST API. The go-mastodon
+// client implements it.
+type StatusLister interface {
+	AccountsSearch(ctx context.Context, q string, limit int64) ([]*mastodon.Account, error)
+	GetAccountStatuses(ctx context.Context, id mastodon.ID, pg *mastodon.Pagination) ([]*mastodon.Status, error)
+}
+
+// Polls the watched accounts' statuses instead of streaming them, for
+// instances where streaming is disabled or blocked. New statuses come out
+// as update events, oldest first, just like the stream.
+type AccountPoller struct {
+	Client   StatusLister
+	Accounts []*WatchedAccount
+	Interval time.Duration
+	Clock    Clock
+}
+
+// Where polling has got to for one account
+type polledAccount struct {
+	watched *WatchedAccount
+	id      mastodon.ID
+	sinceID mastodon.ID
+	started bool
+}
+
+func (p AccountPoller) Events(ctx context.Context) (chan mastodon.Event, error) {
+	accounts := []*polledAccount{}
+	for _, watched := range p.Accounts {
+		accounts = append(accounts, &polledAccount{watched: watched})
+	}
+
+	for _, account := range accounts {
+		if err := p.poll(ctx, account, nil); err != nil {
+			fmt.Println("📮 Failed to poll", account.watched.Acct+":", err)
+		}
+	}
+
+	q := make(chan mastodon.Event)
+	go func() {
+		defer close(q)
+		for {
+			wake := make(chan struct{})
+			timer := p.Clock.AfterFunc(p.Interval, func() { close(wake) })
+			select {
+			case <-wake:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			for _, account := range accounts {
+				if err := p.poll(ctx, account, q); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					fmt.Println("📮 Failed to poll", account.watched.Acct+":", err)
+				}
+			}
+		}
+	}()
+	return q, nil
+}
+
+// Find the ID of a watched account
+func (p AccountPoller) resolve(ctx context.Context, account *polledAccount) error {
+	if account.id != "" {
+		return nil
+	}
+
+	found, err := p.Client.AccountsSearch(ctx, account.watched.Acct, 5)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range found {
+		if account.watched.matches(candidate.Acct) {
+			account.id = candidate.ID
+			return nil
+		}
+	}
+	return fmt.Errorf("no such account")
+}
+
+// Read the statuses posted since last time, oldest first
+func (p AccountPoller) fetch(ctx context.Context, account *polledAccount) ([]*mastodon.Status, error) {
+	statuses, err := p.Client.GetAccountStatuses(ctx, account.id, &mastodon.Pagination{SinceID: account.sinceID})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range statuses {
+		if compareStatusIDs(status.ID, account.sinceID) > 0 {
+			account.sinceID = status.ID
+		}
+	}
+
+	// The newest status comes first
+	for i, j := 0, len(statuses)-1; i < j; i, j = i+1, j-1 {
+		statuses[i], statuses[j] = statuses[j], statuses[i]
+	}
+	return statuses, nil
+}
+
+// Send an account's new statuses down the channel. The first time round,
+// the statuses are only noted: statuses from before the bot started aren't
+// news, just as they aren't on the stream.
+func (p AccountPoller) poll(ctx context.Context, account *polledAccount, q chan mastodon.Event) error {
+	if err := p.resolve(ctx, account); err != nil {
+		return err
+	}
+	statuses, err := p.fetch(ctx, account)
+	if err != nil {
+		return err
+	}
+	if !account.started {
+		account.started = true
+		fmt.Println("📮 Polling", account.watched.Acct, "for statuses after", account.sinceID)
+		return nil
+	}
+	for _, status := range statuses {
+		select {
+		case q <- &mastodon.UpdateEvent{Status: status}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Order status IDs. Mastodon's are numbers, which sort by length first.
+func compareStatusIDs(a, b mastodon.ID) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(string(a), string(b))
+}
+
+// Combines several event sources into one, passing each status on only the
+// first time it's seen. Sources which fail to start are skipped, as long as
+// one of them starts.
+type MergedEvents struct {
+	Sources []EventSource
+}
+
+func (m MergedEvents) Events(ctx context.Context) (chan mastodon.Event, error) {
+	streams := []chan mastodon.Event{}
+	for _, source := range m.Sources {
+		stream, err := source.Events(ctx)
+		if err != nil {
+			fmt.Println("Failed to start an event source:", err)
+			continue
+		}
+		streams = append(streams, stream)
+	}
+	if len(streams) == 0 {
+		return nil, errors.New("no event source could be started")
+	}
+
+	seen := newSeenStatuses(seenStatusesSize)
+	q := make(chan mastodon.Event)
+	var wg sync.WaitGroup
+	for _, stream := range streams {
+		wg.Add(1)
+		go func(stream chan mastodon.Event) {
+			defer wg.Done()
+			for event := range stream {
+				if update, ok := event.(*mastodon.UpdateEvent); ok && !seen.add(update.Status.ID) {
+					continue
+				}
+				select {
+				case q <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(stream)
+	}
+	go func() {
+		wg.Wait()
+		close(q)
+	}()
+	return q, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestMergedEventsPassStatusesOnOnce(t *testing.T) {
+	// setup two sources which overlap
+	first := ArchiveEvents{Records: []ArchiveRecord{
+		{Kind: ArchiveStatus, Status: &mastodon.Status{ID: "1"}},
+		{Kind: ArchiveStatus, Status: &mastodon.Status{ID: "2"}},
+	}}
+	second := ArchiveEvents{Records: []ArchiveRecord{
+		{Kind: ArchiveStatus, Status: &mastodon.Status{ID: "2"}},
+		{Kind: ArchiveStatus, Status: &mastodon.Status{ID: "3"}},
+	}}
+
+	// call function to test
+	stream, err := MergedEvents{Sources: []EventSource{first, second}}.Events(context.Background())
+	if err != nil {
+		t.Fatalf("Events returned error %v", err)
+	}
+
+	// check result
+	counts := map[mastodon.ID]int{}
+	for event := range stream {
+		counts[event.(*mastodon.UpdateEvent).Status.ID]++
+	}
+	if len(counts) != 3 || counts["1"] != 1 || counts["2"] != 1 || counts["3"] != 1 {
+		t.Errorf("merged events delivered statuses %v, want 1, 2 and 3 once each", counts)
+	}
+}
+
+func TestSeenStatusesForgetsOldest(t *testing.T) {
+	seen := newSeenStatuses(2)
+	seen.add("1")
+	seen.add("2")
+	if seen.add("2") {
+		t.Errorf("status 2 wasn't remembered")
+	}
+	seen.add("3")
+	if !seen.add("1") {
+		t.Errorf("status 1 was still remembered after two newer ones")
+	}
+}
+
+func TestCompareStatusIDs(t *testing.T) {
+	if compareStatusIDs("99", "100") >= 0 || compareStatusIDs("110", "109") <= 0 || compareStatusIDs("5", "5") != 0 || compareStatusIDs("1", "") <= 0 {
+		t.Errorf("compareStatusIDs doesn't order IDs as numbers")
+	}
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mattn/go-mastodon"
+)
+
+// An in-process stand-in for a Mastodon server. It serves just enough of
+// the API for the bot: the user stream (both the HTTP and the websocket
+// flavours), statuses, media, and polls. Tests script it by emitting
+// snakebot posts and then checking what the bot posted and voted. Emitted
+// statuses also appear on their account's timeline, for bots which poll.
+type fakeMastodon struct {
+	t      *testing.T
+	server *httptest.Server
+	done   chan struct{}
+
+	mutex      sync.Mutex
+	changed    *sync.Cond
+	nextID     int
+	statuses   map[mastodon.ID]*mastodon.Status
+	polls      map[mastodon.ID]*mastodon.Poll
+	media      map[string][]byte
+	uploads    map[mastodon.ID]*mastodon.Attachment
+	posts      []*mastodon.Status
+	published  []*mastodon.Status
+	edits      []*mastodon.Status
+	votes      []fakeVote
+	streams    []chan fakeStreamEvent
+	streamsSet int
+
+	// How long statuses can be, as the instance reports it
+	maxCharacters int
+	// Whether to turn down every status the bot posts
+	rejectPosts bool
+	// How many of the bot's votes to turn down before accepting them
+	rejectVotes int
+	// How many connections to the user stream to turn down before
+	// accepting them, and how many there have been
+	rejectStreams  int
+	streamAttempts int
+}
+
+// A vote the bot cast
+type fakeVote struct {
+	PollID  mastodon.ID
+	Choices []int
+}
+
+type fakeStreamEvent struct {
+	Event string
+	Data  string
+}
+
+// The account snakebot posts from
+var fakeSnakebotAccount = mastodon.Account{ID: "1", Username: "snake_game", Acct: "snake_game"}
+
+// Someone who follows the bot
+var fakeFollowerAccount = mastodon.Account{ID: "3", Username: "follower", Acct: "follower@example.com"}
+
+// The account the bot posts from
+var fakeAdmirerAccount = mastodon.Account{ID: "2", Username: "snakebot_admirer", Acct: "snakebot_admirer"}
+
+func newFakeMastodon(t *testing.T) *fakeMastodon {
+	f := &fakeMastodon{
+		t:             t,
+		done:          make(chan struct{}),
+		nextID:        100,
+		statuses:      make(map[mastodon.ID]*mastodon.Status),
+		polls:         make(map[mastodon.ID]*mastodon.Poll),
+		media:         make(map[string][]byte),
+		uploads:       make(map[mastodon.ID]*mastodon.Attachment),
+		maxCharacters: defaultMaxCharacters,
+	}
+	f.changed = sync.NewCond(&f.mutex)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/streaming/user", f.handleStreaming)
+	mux.HandleFunc("/api/v1/streaming", f.handleWebsocket)
+	mux.HandleFunc("/api/v1/statuses", f.handlePostStatus)
+	mux.HandleFunc("/api/v1/statuses/", f.handleGetStatus)
+	mux.HandleFunc("/api/v1/polls/", f.handlePoll)
+	mux.HandleFunc("/api/v1/instance", f.handleInstance)
+	mux.HandleFunc("/api/v1/accounts/search", f.handleAccountsSearch)
+	mux.HandleFunc("/api/v2/search", f.handleSearch)
+	mux.HandleFunc("/api/v1/accounts/", f.handleAccountStatuses)
+	mux.HandleFunc("/media/", f.handleMedia)
+	mux.HandleFunc("/api/v1/media", f.handleUpload)
+	f.server = httptest.NewServer(mux)
+
+	t.Cleanup(f.close)
+
+	return f
+}
+
+func (f *fakeMastodon) close() {
+	close(f.done)
+	f.server.Close()
+}
+
+func (f *fakeMastodon) client() *mastodon.Client {
+	return mastodon.NewClient(&mastodon.Config{
+		Server:      f.server.URL,
+		AccessToken: "test-token",
+	})
+}
+
+func (f *fakeMastodon) newID() mastodon.ID {
+	f.nextID++
+	return mastodon.ID(strconv.Itoa(f.nextID))
+}
+
+// Create a board update from snakebot with a rendered image of the game
+// state. The status isn't sent to the bot until it's emitted.
+func (f *fakeMastodon) snakebotBoard(game GameState) *mastodon.Status {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	id := f.newID()
+	status := &mastodon.Status{
+		ID:               id,
+		URL:              f.server.URL + "/@snake_game/" + string(id),
+		Account:          fakeSnakebotAccount,
+		Content:          "<p>The snake moves on</p>",
+		CreatedAt:        time.Now(),
+		MediaAttachments: []mastodon.Attachment{f.boardImage(game)},
+	}
+	f.statuses[id] = status
+	return status
+}
+
+// Serve a rendered image of a game state, as snakebot attaches it
+func (f *fakeMastodon) boardImage(game GameState) mastodon.Attachment {
+	img, err := renderGameStateImage(game, 40)
+	if err != nil {
+		f.t.Fatalf("failed to render board: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		f.t.Fatalf("failed to encode board: %v", err)
+	}
+
+	id := f.newID()
+	mediaName := fmt.Sprintf("board-%s.png", id)
+	f.media[mediaName] = buf.Bytes()
+	return mastodon.Attachment{
+		ID:          id,
+		Type:        "image",
+		URL:         f.server.URL + "/media/" + mediaName,
+		Description: fmt.Sprintf("A %dx%d snake board", game.BoardWidth, game.BoardHeight),
+	}
+}
+
+// Mention the bot from someone's account, with a board image if there's a
+// game, and send the bot the notification
+func (f *fakeMastodon) mention(account mastodon.Account, content string, game *GameState, visibility string) *mastodon.Status {
+	f.mutex.Lock()
+	id := f.newID()
+	status := &mastodon.Status{
+		ID:         id,
+		URL:        f.server.URL + "/@" + account.Acct + "/" + string(id),
+		Account:    account,
+		Content:    `<p><span class="h-card"><a href="` + f.server.URL + `/@snakebot_admirer" class="u-url mention">@<span>snakebot_admirer</span></a></span> ` + content + `</p>`,
+		CreatedAt:  time.Now(),
+		Visibility: visibility,
+		Mentions:   []mastodon.Mention{{ID: fakeAdmirerAccount.ID, Username: fakeAdmirerAccount.Username, Acct: fakeAdmirerAccount.Acct}},
+	}
+	if game != nil {
+		status.MediaAttachments = []mastodon.Attachment{f.boardImage(*game)}
+	}
+	f.statuses[id] = status
+	notification := &mastodon.Notification{ID: f.newID(), Type: "mention", CreatedAt: status.CreatedAt, Account: account, Status: status}
+	f.mutex.Unlock()
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		f.t.Fatalf("failed to encode notification: %v", err)
+	}
+	f.emitRaw("notification", string(data))
+	return status
+}
+
+// Create a poll from snakebot in reply to a board update. The time left is
+// measured from now, so a poll which expires two minutes and a little bit
+// from now wakes the bot up after a little bit.
+func (f *fakeMastodon) snakebotPoll(board *mastodon.Status, timeLeft time.Duration, titles ...string) *mastodon.Status {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	options := []mastodon.PollOption{}
+	for _, title := range titles {
+		options = append(options, mastodon.PollOption{Title: title})
+	}
+
+	now := time.Now()
+	poll := &mastodon.Poll{
+		ID:        f.newID(),
+		ExpiresAt: now.Add(timeLeft),
+		Options:   options,
+	}
+	f.polls[poll.ID] = poll
+
+	id := f.newID()
+	status := &mastodon.Status{
+		ID:          id,
+		URL:         f.server.URL + "/@snake_game/" + string(id),
+		Account:     fakeSnakebotAccount,
+		InReplyToID: string(board.ID),
+		Content:     "<p>What should the snake do next?</p>",
+		CreatedAt:   now,
+		Poll:        poll,
+	}
+	f.statuses[id] = status
+	return status
+}
+
+// Create a status from snakebot in reply to another, with no board or poll
+func (f *fakeMastodon) snakebotReply(parent *mastodon.Status, content string) *mastodon.Status {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	id := f.newID()
+	status := &mastodon.Status{
+		ID:          id,
+		URL:         f.server.URL + "/@snake_game/" + string(id),
+		Account:     fakeSnakebotAccount,
+		InReplyToID: string(parent.ID),
+		Content:     content,
+		CreatedAt:   time.Now(),
+	}
+	f.statuses[id] = status
+	return status
+}
+
+// Record votes from other people on a poll
+func (f *fakeMastodon) setPollVotes(poll *mastodon.Poll, votes ...int64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	poll.VotesCount = 0
+	for idx, count := range votes {
+		poll.Options[idx].VotesCount = count
+		poll.VotesCount += count
+	}
+}
+
+// Publish a status on its account's timeline and send it to the bot on its
+// user stream
+func (f *fakeMastodon) emit(status *mastodon.Status) {
+	f.publish(status)
+	data, err := json.Marshal(status)
+	if err != nil {
+		f.t.Fatalf("failed to encode status: %v", err)
+	}
+	f.emitRaw("update", string(data))
+}
+
+// Publish a status on its account's timeline without streaming it
+func (f *fakeMastodon) publish(status *mastodon.Status) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.published = append(f.published, status)
+}
+
+// Tell the bot on its user stream that a status has been edited
+func (f *fakeMastodon) emitEdit(status *mastodon.Status) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		f.t.Fatalf("failed to encode status: %v", err)
+	}
+	f.emitRaw("status.update", string(data))
+}
+
+// Send an arbitrary event to the bot on its user stream
+func (f *fakeMastodon) emitRaw(event, data string) {
+	f.mutex.Lock()
+	streams := append([]chan fakeStreamEvent{}, f.streams...)
+	f.mutex.Unlock()
+
+	for _, stream := range streams {
+		select {
+		case stream <- fakeStreamEvent{Event: event, Data: data}:
+		case <-f.done:
+		}
+	}
+}
+
+// Wait until a condition on the fake server's state becomes true
+func (f *fakeMastodon) waitFor(what string, timeout time.Duration, condition func() bool) {
+	f.t.Helper()
+
+	timer := time.AfterFunc(timeout, func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.changed.Broadcast()
+	})
+	defer timer.Stop()
+
+	deadline := time.Now().Add(timeout)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for !condition() {
+		if time.Now().After(deadline) {
+			f.t.Fatalf("timed out waiting for %s", what)
+		}
+		f.changed.Wait()
+	}
+}
+
+// Wait until the bot is listening to its stream
+func (f *fakeMastodon) waitForStream() {
+	f.t.Helper()
+	f.waitFor("the bot to connect to the stream", 5*time.Second, func() bool { return f.streamsSet > 0 })
+}
+
+// Wait for the bot to have posted this many statuses, and return them
+func (f *fakeMastodon) waitForPosts(count int) []*mastodon.Status {
+	f.t.Helper()
+	f.waitFor(fmt.Sprintf("%d posts", count), 5*time.Second, func() bool { return len(f.posts) >= count })
+	return f.postedStatuses()
+}
+
+// Wait for the bot to have cast this many votes, and return them
+func (f *fakeMastodon) waitForVotes(count int) []fakeVote {
+	f.t.Helper()
+	f.waitFor(fmt.Sprintf("%d votes", count), 5*time.Second, func() bool { return len(f.votes) >= count })
+	return f.castVotes()
+}
+
+func (f *fakeMastodon) waitForEdits(count int) []*mastodon.Status {
+	f.t.Helper()
+	f.waitFor(fmt.Sprintf("%d edits", count), 5*time.Second, func() bool { return len(f.edits) >= count })
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]*mastodon.Status{}, f.edits...)
+}
+
+func (f *fakeMastodon) postedStatuses() []*mastodon.Status {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]*mastodon.Status{}, f.posts...)
+}
+
+func (f *fakeMastodon) castVotes() []fakeVote {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]fakeVote{}, f.votes...)
+}
+
+func (f *fakeMastodon) subscribe() chan fakeStreamEvent {
+	stream := make(chan fakeStreamEvent)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.streams = append(f.streams, stream)
+	f.streamsSet++
+	f.changed.Broadcast()
+
+	return stream
+}
+
+func (f *fakeMastodon) unsubscribe(stream chan fakeStreamEvent) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for idx, s := range f.streams {
+		if s == stream {
+			f.streams = append(f.streams[:idx], f.streams[idx+1:]...)
+			break
+		}
+	}
+}
+
+// Server-sent events, as read by UserStream
+func (f *fakeMastodon) handleStreaming(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.streamAttempts++
+	f.changed.Broadcast()
+	rejected := f.rejectStreams > 0
+	if rejected {
+		f.rejectStreams--
+	}
+	f.mutex.Unlock()
+	if rejected {
+		http.Error(w, `{"error":"Service unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	stream := f.subscribe()
+	defer f.unsubscribe(stream)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	for {
+		select {
+		case event := <-stream:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, event.Data)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// Websocket events, as used by mastodon.WSClient.StreamingWSUser
+func (f *fakeMastodon) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	stream := f.subscribe()
+	defer f.unsubscribe(stream)
+
+	for {
+		select {
+		case event := <-stream:
+			err := conn.WriteJSON(mastodon.Stream{Event: event.Event, Payload: event.Data})
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-f.done:
+			return
+		}
+	}
+}
+
+func (f *fakeMastodon) writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		f.t.Errorf("failed to encode response: %v", err)
+	}
+}
+
+// POST /api/v1/statuses
+func (f *fakeMastodon) handlePostStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.rejectPosts || statusLength(r.PostForm.Get("status")) > f.maxCharacters {
+		http.Error(w, `{"error":"Validation failed: Text character limit exceeded"}`, http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := f.newID()
+	status := &mastodon.Status{
+		ID:          id,
+		URL:         f.server.URL + "/@snakebot_admirer/" + string(id),
+		Account:     fakeAdmirerAccount,
+		Content:     r.PostForm.Get("status"),
+		CreatedAt:   time.Now(),
+		Visibility:  r.PostForm.Get("visibility"),
+		SpoilerText: r.PostForm.Get("spoiler_text"),
+	}
+	if inReplyToID := r.PostForm.Get("in_reply_to_id"); inReplyToID != "" {
+		status.InReplyToID = inReplyToID
+	}
+	for _, mediaID := range r.PostForm["media_ids[]"] {
+		attachment, ok := f.uploads[mastodon.ID(mediaID)]
+		if !ok {
+			http.Error(w, `{"error":"Media not found"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		status.MediaAttachments = append(status.MediaAttachments, *attachment)
+	}
+	f.statuses[id] = status
+	f.posts = append(f.posts, status)
+	f.changed.Broadcast()
+
+	f.writeJSON(w, status)
+}
+
+// GET and PUT /api/v1/statuses/:id, and GET /api/v1/statuses/:id/context
+func (f *fakeMastodon) handleGetStatus(w http.ResponseWriter, r *http.Request) {
+	path, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/statuses/"), "/")
+	id := mastodon.ID(path)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	status, ok := f.statuses[id]
+	if !ok {
+		http.Error(w, `{"error":"Record not found"}`, http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "context":
+		// Only the statuses above, which is all the bot asks for
+		ancestors := []*mastodon.Status{}
+		for parent, ok := replyParent(status); ok; parent, ok = replyParent(f.statuses[parent]) {
+			if f.statuses[parent] == nil {
+				break
+			}
+			ancestors = append([]*mastodon.Status{f.statuses[parent]}, ancestors...)
+		}
+		f.writeJSON(w, &mastodon.Context{Ancestors: ancestors, Descendants: []*mastodon.Status{}})
+	case r.Method == http.MethodGet:
+		f.writeJSON(w, status)
+	case r.Method == http.MethodPut:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		edited := *status
+		edited.Content = r.PostForm.Get("status")
+		f.statuses[id] = &edited
+		f.edits = append(f.edits, &edited)
+		f.changed.Broadcast()
+		f.writeJSON(w, &edited)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /api/v1/instance, with the character limit where Mastodon 4 has it
+func (f *fakeMastodon) handleInstance(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.writeJSON(w, map[string]interface{}{
+		"uri":   "fake.example",
+		"title": "Fake Mastodon",
+		"configuration": map[string]interface{}{
+			"statuses": map[string]interface{}{"max_characters": f.maxCharacters},
+		},
+	})
+}
+
+// GET /api/v1/polls/:id and POST /api/v1/polls/:id/votes
+func (f *fakeMastodon) handlePoll(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/polls/")
+	id, action, _ := strings.Cut(path, "/")
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	poll, ok := f.polls[mastodon.ID(id)]
+	if !ok {
+		http.Error(w, `{"error":"Record not found"}`, http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		f.writeJSON(w, poll)
+	case r.Method == http.MethodPost && action == "votes":
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.rejectVotes > 0 {
+			f.rejectVotes--
+			http.Error(w, `{"error":"Service unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		vote := fakeVote{PollID: poll.ID}
+		for _, value := range r.PostForm["choices[]"] {
+			choice, err := strconv.Atoi(value)
+			if err != nil || choice < 0 || choice >= len(poll.Options) {
+				http.Error(w, `{"error":"Validation failed"}`, http.StatusUnprocessableEntity)
+				return
+			}
+			vote.Choices = append(vote.Choices, choice)
+			poll.Options[choice].VotesCount++
+			poll.VotesCount++
+		}
+		poll.Voted = true
+		f.votes = append(f.votes, vote)
+		f.changed.Broadcast()
+		f.writeJSON(w, poll)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// GET /api/v2/search, which only finds statuses by their URL
+func (f *fakeMastodon) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	results := mastodon.Results{Accounts: []*mastodon.Account{}, Statuses: []*mastodon.Status{}, Hashtags: []*mastodon.Tag{}}
+	for _, status := range f.statuses {
+		if status.URL == q {
+			results.Statuses = append(results.Statuses, status)
+		}
+	}
+	f.writeJSON(w, results)
+}
+
+// GET /api/v1/accounts/search
+func (f *fakeMastodon) handleAccountsSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimPrefix(r.URL.Query().Get("q"), "@")
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	found := []mastodon.Account{}
+	seen := map[mastodon.ID]bool{}
+	for _, account := range []mastodon.Account{fakeSnakebotAccount, fakeAdmirerAccount} {
+		seen[account.ID] = true
+		if strings.HasPrefix(account.Acct, q) || strings.HasPrefix(q, account.Acct+"@") {
+			found = append(found, account)
+		}
+	}
+	for _, status := range f.published {
+		if !seen[status.Account.ID] && strings.EqualFold(status.Account.Acct, q) {
+			seen[status.Account.ID] = true
+			found = append(found, status.Account)
+		}
+	}
+	f.writeJSON(w, found)
+}
+
+// GET /api/v1/accounts/:id/statuses, newest first
+func (f *fakeMastodon) handleAccountStatuses(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/accounts/")
+	id, action, _ := strings.Cut(path, "/")
+	if action != "statuses" {
+		http.NotFound(w, r)
+		return
+	}
+	sinceID := mastodon.ID(r.URL.Query().Get("since_id"))
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	statuses := []*mastodon.Status{}
+	for idx := len(f.published) - 1; idx >= 0; idx-- {
+		status := f.published[idx]
+		if string(status.Account.ID) == id && compareStatusIDs(status.ID, sinceID) > 0 {
+			statuses = append(statuses, status)
+		}
+	}
+	f.writeJSON(w, statuses)
+}
+
+// POST /api/v1/media. Only PNGs are accepted, which is all the bot uploads.
+func (f *fakeMastodon) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if _, err := png.Decode(file); err != nil {
+		http.Error(w, `{"error":"File could not be processed"}`, http.StatusUnprocessableEntity)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	id := f.newID()
+	attachment := &mastodon.Attachment{
+		ID:          id,
+		Type:        "image",
+		URL:         f.server.URL + "/media/upload-" + string(id) + ".png",
+		Description: r.FormValue("description"),
+	}
+	f.uploads[id] = attachment
+	f.writeJSON(w, attachment)
+}
+
+// GET /media/:name
+func (f *fakeMastodon) handleMedia(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/media/")
+
+	f.mutex.Lock()
+	data, ok := f.media[name]
+	f.mutex.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
+}
@@ -1,13 +1,109 @@
 package main
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Position struct {
-	X, Y int
+	X int `json:"x"`
+	Y int `json:"y"`
 }
 
+// The most spaces along either side of a board the bot will take on.
+// Snakebot's boards are much smaller; this keeps boards people send in from
+// using up all the memory.
+const maxBoardSide = 100
+
 type GameState struct {
-	BoardWidth  int
-	BoardHeight int
-	SnakeShape  []Position
-	Food        Position
-	Direction   string
+	BoardWidth  int        `json:"board_width"`
+	BoardHeight int        `json:"board_height"`
+	SnakeShape  []Position `json:"snake_shape"`
+	Food        Position   `json:"food"`
+	Direction   string     `json:"direction"`
+}
+
+// Everything wrong with a game state
+type GameStateError struct {
+	Problems []string
+}
+
+func (e *GameStateError) Error() string {
+	return "invalid game state: " + strings.Join(e.Problems, "; ")
+}
+
+// Check that a game state is one snakebot could actually show: the snake
+// and food are on the board, each segment of the snake is next to the one
+// before it, nothing is on top of anything else, and the snake is heading
+// away from its neck. The food can only be under the snake once the snake
+// fills the whole board, and the board is no bigger than maxBoardSide
+// each way. Returns a GameStateError listing every problem.
+func (g GameState) Validate() error {
+	problems := []string{}
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	sized := g.BoardWidth > 0 && g.BoardHeight > 0
+	if !sized {
+		problem("board size %dx%d isn't positive", g.BoardWidth, g.BoardHeight)
+	}
+	if g.BoardWidth > maxBoardSide || g.BoardHeight > maxBoardSide {
+		problem("board size %dx%d is bigger than %dx%d", g.BoardWidth, g.BoardHeight, maxBoardSide, maxBoardSide)
+	}
+	inBoard := func(pos Position) bool {
+		return pos.X >= 0 && pos.X < g.BoardWidth && pos.Y >= 0 && pos.Y < g.BoardHeight
+	}
+
+	if len(g.SnakeShape) == 0 {
+		problem("there is no snake")
+	}
+	segments := map[Position]int{}
+	for idx, pos := range g.SnakeShape {
+		if sized && !inBoard(pos) {
+			problem("snake segment %d at %v is outside the board", idx, pos)
+		}
+		if idx > 0 && adjacencyTowards(g.SnakeShape[idx-1], pos) == UndefAdj {
+			problem("snake segment %d at %v isn't next to segment %d at %v", idx, pos, idx-1, g.SnakeShape[idx-1])
+		}
+		if other, ok := segments[pos]; ok {
+			problem("snake segment %d at %v is on top of segment %d", idx, pos, other)
+		} else {
+			segments[pos] = idx
+		}
+	}
+
+	if sized && !inBoard(g.Food) {
+		problem("food at %v is outside the board", g.Food)
+	}
+	if idx, ok := segments[g.Food]; ok && len(segments) < g.BoardWidth*g.BoardHeight {
+		problem("food at %v is under snake segment %d", g.Food, idx)
+	}
+
+	switch g.Direction {
+	case "", "up", "down", "left", "right":
+		if g.Direction != "" && len(g.SnakeShape) > 1 {
+			neck := g.SnakeShape[1]
+			if side := adjacencyTowards(neck, g.SnakeShape[0]); side != UndefAdj && sideDirections[side] != g.Direction {
+				problem("the snake is heading %s but its head is %s of its neck", g.Direction, sideDirections[side])
+			}
+		}
+	default:
+		problem("unknown direction %q", g.Direction)
+	}
+
+	if len(problems) > 0 {
+		return &GameStateError{Problems: problems}
+	}
+	return nil
+}
+
+// In debug builds, stop as soon as a game state breaks an invariant
+func debugValidate(where string, game GameState) {
+	if !debugChecks {
+		return
+	}
+	if err := game.Validate(); err != nil {
+		panic(fmt.Sprintf("%s: %v", where, err))
+	}
 }
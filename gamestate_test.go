@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateAcceptsGoodGameStates(t *testing.T) {
+	// setup: a snake filling its board, which leaves the food under it
+	fullBoard := GameState{
+		BoardWidth:  2,
+		BoardHeight: 2,
+		SnakeShape:  []Position{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}},
+		Food:        Position{X: 0, Y: 0},
+		Direction:   "left",
+	}
+	games := []GameState{doomedGame, safeGame, boardTextGame, fullBoard}
+
+	for _, game := range games {
+		// call function to test
+		err := game.Validate()
+
+		// check result
+		if err != nil {
+			t.Errorf("Validate(%v) returned error %v", game, err)
+		}
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	// setup
+	tests := []struct {
+		name string
+		game GameState
+		want []string
+	}{
+		{"no board", GameState{SnakeShape: []Position{{X: 0, Y: 0}}}, []string{"board size 0x0 isn't positive"}},
+		{"no snake", GameState{BoardWidth: 8, BoardHeight: 5, Food: Position{X: 1, Y: 1}}, []string{"there is no snake"}},
+		{"broken snake", GameState{
+			BoardWidth:  8,
+			BoardHeight: 5,
+			SnakeShape:  []Position{{X: 3, Y: 2}, {X: 2, Y: 2}, {X: 0, Y: 2}},
+			Food:        Position{X: 6, Y: 2},
+			Direction:   "right",
+		}, []string{"snake segment 2 at {0 2} isn't next to segment 1 at {2 2}"}},
+		{"everything wrong", GameState{
+			BoardWidth:  8,
+			BoardHeight: 5,
+			SnakeShape:  []Position{{X: 7, Y: 2}, {X: 8, Y: 2}, {X: 7, Y: 2}},
+			Food:        Position{X: 7, Y: 2},
+			Direction:   "right",
+		}, []string{
+			"snake segment 1 at {8 2} is outside the board",
+			"snake segment 2 at {7 2} is on top of segment 0",
+			"food at {7 2} is under snake segment 0",
+			"the snake is heading right but its head is left of its neck",
+		}},
+		{"food off the board", GameState{
+			BoardWidth:  8,
+			BoardHeight: 5,
+			SnakeShape:  []Position{{X: 3, Y: 2}, {X: 2, Y: 2}},
+			Food:        Position{X: 3, Y: -1},
+			Direction:   "sideways",
+		}, []string{"food at {3 -1} is outside the board", `unknown direction "sideways"`}},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		err := test.game.Validate()
+
+		// check result
+		var gameStateErr *GameStateError
+		if !errors.As(err, &gameStateErr) {
+			t.Errorf("Validate with %s returned %v, want a GameStateError", test.name, err)
+			continue
+		}
+		if strings.Join(gameStateErr.Problems, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("Validate with %s returned problems %q, want %q", test.name, gameStateErr.Problems, test.want)
+		}
+	}
+}
@@ -2,9 +2,9 @@ module mypalmike.com/snakebot_admirer
 
 go 1.18
 
-require github.com/mattn/go-mastodon v0.0.6
-
 require (
-	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/tomnomnom/linkheader v0.0.0-20180905144013-02ca5825eb80 // indirect
+	github.com/gorilla/websocket v1.5.0
+	github.com/mattn/go-mastodon v0.0.6
 )
+
+require github.com/tomnomnom/linkheader v0.0.0-20180905144013-02ca5825eb80 // indirect
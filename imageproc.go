@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"image"
+	"io"
 	"math"
 	"net/http"
 	"regexp"
 	"strconv"
+	"time"
 )
 
 // Define the RGB values for food, snake, and black
@@ -45,17 +48,75 @@ type color struct {
 	r, g, b uint32
 }
 
+// The colours snakebot draws its boards in. Clones of snakebot may use
+// different ones.
+type Palette struct {
+	Snake color
+	Food  color
+	Eyes  []color
+}
+
+var defaultPalette = Palette{
+	Snake: snakeColor,
+	Food:  foodColor,
+	Eyes:  []color{blackColor, whiteColor},
+}
+
+// Parse a colour written as #RRGGBB
+func parseHexColor(hex string) (color, error) {
+	var c color
+	if len(hex) != 7 || hex[0] != '#' {
+		return c, fmt.Errorf("colour %q should be written as #RRGGBB", hex)
+	}
+	value, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return c, fmt.Errorf("colour %q should be written as #RRGGBB", hex)
+	}
+	return color{uint32(value >> 16 & 0xFF), uint32(value >> 8 & 0xFF), uint32(value & 0xFF)}, nil
+}
+
+// Limits on the images the bot downloads. Board images are small, but
+// anyone can mention the bot with an image, so the download has to end in
+// good time and the image has to be a sensible size before it's decoded.
+const (
+	imageDownloadTimeout = 30 * time.Second
+	maxImageBytes        = 16 << 20
+	maxImagePixels       = 4096 * 4096
+)
+
+var imageClient = &http.Client{Timeout: imageDownloadTimeout}
+
 func downloadImage(imageURL string) (image.Image, error) {
 	// Send HTTP GET request to download the image
-	response, err := http.Get(imageURL)
+	response, err := imageClient.Get(imageURL)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", imageURL, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageBytes {
+		return nil, fmt.Errorf("image is bigger than %d bytes", maxImageBytes)
+	}
+
+	// Check the image's size from its header before decoding the pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image is %dx%d pixels, too big to be a board", config.Width, config.Height)
+	}
 
 	// Read and decode the image data.
 	// The image.Decode function will automatically detect the image type and decode it.
-	imageReader, _, err := image.Decode(response.Body)
+	imageReader, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +313,7 @@ func generateSnakeShape(gridData [][]SnakeSpace) ([]Position, error) {
 	return snakeArray, nil
 }
 
-func convertImageGridToSnakeSpaceGrid(imageGrid [][]image.Image) ([][]SnakeSpace, error) {
+func convertImageGridToSnakeSpaceGrid(imageGrid [][]image.Image, palette Palette) ([][]SnakeSpace, error) {
 	gridSizeY := len(imageGrid)
 	if gridSizeY == 0 {
 		return nil, errors.New("empty image grid in y direction")
@@ -271,7 +332,7 @@ func convertImageGridToSnakeSpaceGrid(imageGrid [][]image.Image) ([][]SnakeSpace
 	// First pass: Categorize center points of each grid
 	for y := 0; y < gridSizeY; y++ {
 		for x := 0; x < gridSizeX; x++ {
-			snakeSpaceGrid[y][x].SnakeSlot = sampleSnakeSlot(imageGrid[y][x])
+			snakeSpaceGrid[y][x].SnakeSlot = sampleSnakeSlot(imageGrid[y][x], palette)
 		}
 	}
 
@@ -279,7 +340,7 @@ func convertImageGridToSnakeSpaceGrid(imageGrid [][]image.Image) ([][]SnakeSpace
 	for y := 0; y < gridSizeY; y++ {
 		for x := 0; x < gridSizeX; x++ {
 			if snakeSpaceGrid[y][x].SnakeSlot == Snake {
-				adjacencies, err := sampleAdjacencies(imageGrid[y][x])
+				adjacencies, err := sampleAdjacencies(imageGrid[y][x], palette)
 				if err != nil {
 					return nil, err
 				}
@@ -292,7 +353,7 @@ func convertImageGridToSnakeSpaceGrid(imageGrid [][]image.Image) ([][]SnakeSpace
 	for y := 0; y < gridSizeY; y++ {
 		for x := 0; x < gridSizeX; x++ {
 			if snakeSpaceGrid[y][x].SnakeSlot == Snake && countBits(int64(snakeSpaceGrid[y][x].Adjacencies)) == 1 {
-				if sampleEyes(imageGrid[y][x]) {
+				if sampleEyes(imageGrid[y][x], palette) {
 					snakeSpaceGrid[y][x].SnakeSlot = Head
 				}
 			}
@@ -302,7 +363,7 @@ func convertImageGridToSnakeSpaceGrid(imageGrid [][]image.Image) ([][]SnakeSpace
 	return snakeSpaceGrid, nil
 }
 
-func sampleSnakeSlot(img image.Image) SnakeSlot {
+func sampleSnakeSlot(img image.Image, palette Palette) SnakeSlot {
 	bounds := img.Bounds()
 
 	centerX := bounds.Min.X + (bounds.Dx() / 2)
@@ -313,20 +374,20 @@ func sampleSnakeSlot(img image.Image) SnakeSlot {
 	red >>= 8
 	green >>= 8
 	blue >>= 8
-	return snakeSlotFromColor(color{red, green, blue})
+	return snakeSlotFromColor(color{red, green, blue}, palette)
 }
 
-func snakeSlotFromColor(pixel color) SnakeSlot {
-	if compareColors(pixel, snakeColor) {
+func snakeSlotFromColor(pixel color, palette Palette) SnakeSlot {
+	if compareColors(pixel, palette.Snake) {
 		return Snake
-	} else if compareColors(pixel, foodColor) {
+	} else if compareColors(pixel, palette.Food) {
 		return Food
 	}
 
 	return Empty
 }
 
-func sampleAdjacencies(img image.Image) (Adjacencies, error) {
+func sampleAdjacencies(img image.Image, palette Palette) (Adjacencies, error) {
 	// Get the dimensions of the grid image
 	imageWidth := img.Bounds().Dx()
 	imageHeight := img.Bounds().Dy()
@@ -356,7 +417,7 @@ func sampleAdjacencies(img image.Image) (Adjacencies, error) {
 		blue >>= 8
 
 		// Check if the midpoint matches the snake color
-		if compareColors(color{red, green, blue}, snakeColor) {
+		if compareColors(color{red, green, blue}, palette.Snake) {
 			adjacencyCount++
 
 			newAdjacency := UndefAdj
@@ -386,7 +447,7 @@ func sampleAdjacencies(img image.Image) (Adjacencies, error) {
 	return adjacencies, nil
 }
 
-func sampleEyes(img image.Image) bool {
+func sampleEyes(img image.Image, palette Palette) bool {
 	// Iterate over one diagonal of the image looking for the eyes (black or white pixels)
 	bounds := img.Bounds()
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
@@ -397,8 +458,10 @@ func sampleEyes(img image.Image) bool {
 		green >>= 8
 		blue >>= 8
 
-		if compareColors(color{red, green, blue}, blackColor) || compareColors(color{red, green, blue}, whiteColor) {
-			return true
+		for _, eyeColor := range palette.Eyes {
+			if compareColors(color{red, green, blue}, eyeColor) {
+				return true
+			}
 		}
 	}
 
@@ -474,3 +537,70 @@ func determineHeadDirection(snakeSpaceGrid [][]SnakeSpace) (string, error) {
 
 	return "", fmt.Errorf("could not determine head direction")
 }
+
+// Build a SnakeSpace grid from a game state. This is the inverse of
+// convertSnakeSpaceGridToGameState, and is used to draw boards that
+// didn't come from an image.
+func convertGameStateToSnakeSpaceGrid(game GameState) ([][]SnakeSpace, error) {
+	if game.BoardWidth <= 0 || game.BoardHeight <= 0 {
+		return nil, fmt.Errorf("invalid board size %dx%d", game.BoardWidth, game.BoardHeight)
+	}
+	if len(game.SnakeShape) == 0 {
+		return nil, errors.New("game state has no snake")
+	}
+
+	snakeSpaceGrid := make([][]SnakeSpace, game.BoardHeight)
+	for y := range snakeSpaceGrid {
+		snakeSpaceGrid[y] = make([]SnakeSpace, game.BoardWidth)
+		for x := range snakeSpaceGrid[y] {
+			snakeSpaceGrid[y][x].SnakeSlot = Empty
+		}
+	}
+
+	inBoard := func(pos Position) bool {
+		return pos.X >= 0 && pos.X < game.BoardWidth && pos.Y >= 0 && pos.Y < game.BoardHeight
+	}
+
+	if !inBoard(game.Food) {
+		return nil, fmt.Errorf("food at %v is outside the board", game.Food)
+	}
+	snakeSpaceGrid[game.Food.Y][game.Food.X].SnakeSlot = Food
+
+	for idx, pos := range game.SnakeShape {
+		if !inBoard(pos) {
+			return nil, fmt.Errorf("snake segment %d at %v is outside the board", idx, pos)
+		}
+
+		adjacencies := UndefAdj
+		if idx > 0 {
+			adjacencies |= adjacencyTowards(pos, game.SnakeShape[idx-1])
+		}
+		if idx < len(game.SnakeShape)-1 {
+			adjacencies |= adjacencyTowards(pos, game.SnakeShape[idx+1])
+		}
+
+		slot := Snake
+		if idx == 0 {
+			slot = Head
+		}
+		snakeSpaceGrid[pos.Y][pos.X] = SnakeSpace{SnakeSlot: slot, Adjacencies: adjacencies}
+	}
+
+	return snakeSpaceGrid, nil
+}
+
+// Returns the adjacency bit pointing from one position to a neighbouring one,
+// or UndefAdj if the positions aren't neighbours
+func adjacencyTowards(from, to Position) Adjacencies {
+	switch {
+	case to.X == from.X && to.Y == from.Y-1:
+		return Up
+	case to.X == from.X && to.Y == from.Y+1:
+		return Down
+	case to.X == from.X-1 && to.Y == from.Y:
+		return Left
+	case to.X == from.X+1 && to.Y == from.Y:
+		return Right
+	}
+	return UndefAdj
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadImageRejectsHugeImages(t *testing.T) {
+	// setup: a tiny PNG whose header claims it's enormous
+	var data bytes.Buffer
+	if err := png.Encode(&data, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	header := data.Bytes()
+	// The IHDR chunk follows the 8 byte signature: length, type, width,
+	// height and the rest of its fields, then its CRC
+	binary.BigEndian.PutUint32(header[16:], 100000)
+	binary.BigEndian.PutUint32(header[20:], 100000)
+	binary.BigEndian.PutUint32(header[29:], crc32.ChecksumIEEE(header[12:29]))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(header)
+	}))
+	defer server.Close()
+
+	// call function to test
+	_, err := downloadImage(server.URL + "/huge.png")
+
+	// check result
+	if err == nil || !strings.Contains(err.Error(), "100000x100000") {
+		t.Errorf("downloadImage returned error %v, want one about the image's size", err)
+	}
+}
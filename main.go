@@ -4,185 +4,424 @@ import (
 	"context"
 	"fmt"
 	_ "image/png"
-	"log"
 	"os"
 	"time"
 
 	"github.com/mattn/go-mastodon"
 )
 
+// How long before a poll expires the bot checks whether it needs to vote, by
+// default
+const pollCheckLead = 2 * time.Minute
+
 func main() {
-	// Uncomment this to test the code without connecting to Mastodon
-	// testMain()
-	// return
-
-	mastodonServer := os.Getenv("MASTODON_SERVER")
-	clientKey := os.Getenv("CLIENT_KEY")
-	clientSecret := os.Getenv("CLIENT_SECRET")
-	accessToken := os.Getenv("ACCESS_TOKEN")
-
-	client := mastodon.NewClient(&mastodon.Config{
-		Server:       mastodonServer,
-		ClientID:     clientKey,
-		ClientSecret: clientSecret,
-		AccessToken:  accessToken,
-	})
+	os.Exit(runCommandLine(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// How the bot behaves
+type BotConfig struct {
+	// Decides when the bot votes
+	Policy VotePolicy
+
+	// When to look at each poll, unless an account's rules say otherwise.
+	// The default is shortly before it expires.
+	CheckIns []CheckIn
+
+	// The snake games to watch. The default is snakebot.
+	Accounts []*WatchedAccount
 
-	fmt.Println("Connected to Mastodon server")
+	// Where to record snakebot's statuses, if anywhere
+	Archive *ArchiveWriter
+
+	// How the bot's posts are threaded and who sees them
+	Posting PostingConfig
+
+	// Writes the bot's posts. The default uses the built in templates. The
+	// character limit is read from the instance when the bot starts.
+	Composer *Composer
+
+	// Whether and how often the bot answers people who mention it with a
+	// board of their own
+	Puzzles PuzzleConfig
+
+	// The accounts which can send the bot commands as direct messages, and
+	// where to record the commands
+	Admins []string
+	Audit  *AuditLog
+
+	// Who to warn by direct message when the snake is about to die
+	Alerts AlertConfig
+}
+
+// Run the bot: follow snakebot on the user's timeline, post analyses of its
+// boards and vote on its polls when needed. Returns when the context is
+// cancelled.
+func runBot(ctx context.Context, services BotServices, config BotConfig) error {
+	// Everything the bot starts stops with it, including when an archive
+	// runs out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	config.Composer = instanceComposer(ctx, services, config.Composer, config.Posting.ContentWarning)
+	config.Posting.Boards = config.Posting.Boards.withDefaults()
+
+	// Admins can pause voting, change the policy and turn on a dry run.
+	// Their acknowledgements go out even during a dry run.
+	controls := newBotControls(config.Policy)
+	adminPublisher := services.Publisher
+	services = withDryRun(services, controls)
 
 	// Create a channel and goroutine to process votes on polls
 	pollChannel := make(chan PollMessage)
-	go processPolls(pollChannel, client)
+	scheduler := newPollScheduler(services.Clock)
+	go processPolls(ctx, pollChannel, services, config, controls, scheduler)
+
+	// Poll checks are timed by the clock of the server each snake game is
+	// on, which we learn from the timestamps of its posts
+	serverClocks := newServerClocks(services.Clock)
+	checkIns := config.CheckIns
+	if len(checkIns) == 0 {
+		checkIns = defaultCheckIns
+	}
+	accounts := config.Accounts
+	if len(accounts) == 0 {
+		accounts = defaultWatchedAccounts()
+	}
 
 	// Create a channel to receive updates from the user's home timeline
-	stream, err := client.StreamingUser(context.Background())
+	stream, err := services.Events.Events(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	fmt.Println("Listening to Mastodon stream")
 
+	// Statuses can arrive more than once, for example when the stream
+	// reconnects, so remember which ones have been handled
+	seen := newSeenStatuses(seenStatusesSize)
+	analysisPosts := newAnalysisPosts(seenStatusesSize)
+	gameThreads := newGameThreads()
+	puzzleLimiter := newPuzzleLimiter(config.Puzzles, services.Clock)
+	subscriptionLimiter := newAccountLimiter(subscriptionLimit, subscriptionWindow, services.Clock)
+
+	// Puzzles are answered by their own worker. People mostly send the
+	// boards of the first game the bot watches, so images are read by its
+	// rules.
+	puzzleQueue := make(chan PuzzleRequest, puzzleQueueSize)
+	if config.Puzzles.Enabled {
+		go processPuzzles(ctx, puzzleQueue, services, config, accounts[0].Rules)
+	}
+
+	var admin *AdminConsole
+	if len(config.Admins) > 0 {
+		admin = &AdminConsole{
+			admins:      config.Admins,
+			controls:    controls,
+			audit:       config.Audit,
+			publisher:   adminPublisher,
+			composer:    config.Composer,
+			clock:       services.Clock,
+			scheduler:   scheduler,
+			pollChannel: pollChannel,
+			reanalyse: func(statusURL string) (string, error) {
+				board, account, err := findBoardStatus(ctx, services.Search, accounts, statusURL)
+				if err != nil {
+					return "", err
+				}
+				if err := handleBoardUpdate(ctx, services, config, pollChannel, account, analysisPosts, gameThreads, &mastodon.UpdateEvent{Status: board}, true); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Analysed board %s from %s again.", board.ID, account.Acct), nil
+			},
+		}
+	}
+
 	// Start listening to the Mastodon stream
 	for event := range stream {
 		fmt.Println("Received event:", event)
+		var update *mastodon.UpdateEvent
+		edited := false
 		switch event := event.(type) {
+		case *StatusEditEvent:
+			fmt.Println("-> and it's an edit of a status from " + event.Status.Account.Acct)
+			update = event.UpdateEvent
+			edited = true
 		case *mastodon.UpdateEvent:
 			fmt.Println("-> and it's an update event from " + event.Status.Account.Acct)
-			// Check if the update is from the snake bot
-			if event.Status.Account.Acct == "snake_game@botsin.space" || event.Status.Account.Acct == "snake_game" {
-				fmt.Println("-> and it's from the snake bot")
-				if event.Status.Poll != nil {
-					fmt.Println("-> and it's got a poll")
-
-					// Type of InReplyToID is interface{}, so we need to convert it to a string
-					originalStatusIdStr := mastodon.ID(fmt.Sprintf("%v", event.Status.InReplyToID))
-
-					// Send a message to the poll processing goroutine
-					pollChannel <- PollMessage{
-						MessageType: NewPoll,
-						UpdateID:    originalStatusIdStr,
-						PollID:      event.Status.Poll.ID,
-						PollOptions: event.Status.Poll.Options,
-					}
-
-					// Run timer coroutine to wake up two minutes before the poll expires
-					go func() {
-						// Sleep until two minutes before the poll expires
-						sleepTime := event.Status.Poll.ExpiresAt.Sub(event.Status.CreatedAt) - (2 * time.Minute)
-						fmt.Println("⏰ Timer coroutine sleeping for", sleepTime)
-						time.Sleep(sleepTime)
-
-						fmt.Println("⏰ Timer coroutine woke up. Sending message to poll processing goroutine")
-
-						// After waking up, send a message to the poll processing goroutine
-						pollChannel <- PollMessage{
-							MessageType: TimerCheck,
-							UpdateID:    originalStatusIdStr,
-							PollID:      event.Status.Poll.ID,
-						}
-					}()
-
-				} else if len(event.Status.MediaAttachments) > 0 && event.Status.MediaAttachments[0].Type == "image" {
-					// Process the image
-					fmt.Println("-> and it's got an image")
-
-					imageData, err := downloadImage(event.Status.MediaAttachments[0].URL)
-					if err != nil {
-						fmt.Println("Failed to download image:", err)
-						return
-					}
-
-					fmt.Println("Image downloaded")
-
-					croppedImageData, err := autocropImage(imageData)
-					if err != nil {
-						fmt.Println("Failed to autocrop image:", err)
-						return
-					}
-
-					fmt.Println("Image cropped")
-
-					// Extract board dimensions from ALT data
-					boardWidth, boardHeight, err := extractBoardDimensions(event.Status.MediaAttachments[0].Description)
-					if err != nil {
-						fmt.Println("Failed to extract board dimensions:", err)
-						return
-					}
-
-					fmt.Println("Board dimensions extracted")
-
-					imageGrid, err := imageToGridImages(croppedImageData, boardWidth, boardHeight)
-					if err != nil {
-						fmt.Println("Failed to convert image to grid images:", err)
-						return
-					}
-
-					fmt.Println("Image converted to grid images")
-
-					snakeSpaceGrid, err := convertImageGridToSnakeSpaceGrid(imageGrid)
-					if err != nil {
-						fmt.Println("Failed to convert image grid to SnakeSpace grid:", err)
-						return
-					}
-
-					fmt.Println("Image grid converted to SnakeSpace grid")
-
-					gameState, err := convertSnakeSpaceGridToGameState(snakeSpaceGrid)
-					if err != nil {
-						fmt.Println("Failed to convert SnakeSpace grid to game state:", err)
-						return
-					}
-
-					fmt.Println("SnakeSpace grid converted to game state")
-
-					// Get the best move
-					bestMove, mustTurn := determineNextMove(gameState)
-
-					fmt.Println("Best move determined")
-
-					// Respond to the post with the chosen move
-					myUpdateId := makePost(client, event, snakeSpaceGrid, bestMove, mustTurn)
-
-					// Tell the poll processing goroutine that we've made a post
-					pollChannel <- PollMessage{
-						MessageType: NewState,
-						UpdateID:    event.Status.ID,
-						MyVote:      bestMove,
-						MustTurn:    mustTurn,
-						MyUpdateId:  myUpdateId,
-					}
-
-					fmt.Println("Post made")
-				}
+			update = event
+		case *mastodon.NotificationEvent:
+			mention := event.Notification.Status
+			if event.Notification.Type != "mention" || mention == nil {
+				continue
+			}
+			fmt.Println("-> and it's a mention from " + mention.Account.Acct)
+			if !seen.add(mention.ID) {
+				continue
+			}
+			if handleSubscription(services, config, subscriptionLimiter, mention) || admin.handle(mention) {
+				continue
+			}
+			if config.Puzzles.Enabled {
+				handleMention(puzzleQueue, puzzleLimiter, mention)
+			}
+			continue
+		default:
+			continue
+		}
+
+		// Check if the update is from one of the snake games we watch
+		account := findWatchedAccount(accounts, update.Status.Account.Acct)
+		if account == nil {
+			continue
+		}
+		fmt.Println("-> and it's from the snake game", account.Acct)
+
+		if update.Status.Reblog != nil {
+			fmt.Println("-> but it's a boost, so ignoring it")
+			continue
+		}
+		if !seen.add(update.Status.ID) && !edited {
+			fmt.Println("-> but it's been seen already, so ignoring it")
+			continue
+		}
+		if !edited {
+			serverClocks.forAcct(account.Acct).observe(update.Status.CreatedAt)
+		}
+
+		if config.Archive != nil {
+			if err := config.Archive.writeStatus(update.Status); err != nil {
+				fmt.Println("Failed to archive status:", err)
+			}
+		}
+
+		if update.Status.Poll != nil {
+			fmt.Println("-> and it's got a poll")
+			accountCheckIns := checkIns
+			if len(account.Rules.CheckIns) > 0 {
+				accountCheckIns = account.Rules.CheckIns
+			}
+			handlePollUpdate(ctx, services, pollChannel, scheduler, serverClocks.forAcct(account.Acct), account, accountCheckIns, config.Alerts, analysisPosts, update)
+		} else if len(update.Status.MediaAttachments) > 0 && update.Status.MediaAttachments[0].Type == "image" {
+			fmt.Println("-> and it's got an image")
+			if err := handleBoardUpdate(ctx, services, config, pollChannel, account, analysisPosts, gameThreads, update, edited); err != nil {
+				fmt.Println("Board not handled:", err)
 			}
 		}
 	}
+
+	return nil
 }
 
-func makePost(client *mastodon.Client, event *mastodon.UpdateEvent, snakeSpaceGrid [][]SnakeSpace, move string, mustTurn bool) mastodon.ID {
-	fmt.Println("Making mastodon post")
+// Our analysis posts, by the board they analyse, so that when a board is
+// edited its analysis can be edited too. Only the most recent boards are
+// remembered.
+type AnalysisPosts struct {
+	size  int
+	posts map[mastodon.ID]mastodon.ID
+	order []mastodon.ID
+}
+
+func newAnalysisPosts(size int) *AnalysisPosts {
+	return &AnalysisPosts{size: size, posts: make(map[mastodon.ID]mastodon.ID)}
+}
 
-	// Implement post reply logic here
-	gridStr := snakeSpaceGridAsString(snakeSpaceGrid)
+func (a *AnalysisPosts) add(boardID, postID mastodon.ID) {
+	if _, ok := a.posts[boardID]; !ok {
+		a.order = append(a.order, boardID)
+	}
+	a.posts[boardID] = postID
+	if len(a.order) > a.size {
+		delete(a.posts, a.order[0])
+		a.order = a.order[1:]
+	}
+}
+
+func (a *AnalysisPosts) get(boardID mastodon.ID) (mastodon.ID, bool) {
+	postID, ok := a.posts[boardID]
+	return postID, ok
+}
+
+func handlePollUpdate(ctx context.Context, services BotServices, pollChannel chan PollMessage, scheduler *PollScheduler, serverClock *ServerClock, account *WatchedAccount, checkIns []CheckIn, alerts AlertConfig, analysisPosts *AnalysisPosts, event *mastodon.UpdateEvent) {
+	// The worker matches the poll to the board it's about
+	knownBoard := func(id mastodon.ID) bool {
+		_, ok := analysisPosts.get(id)
+		return ok
+	}
+	boardID, err := findPollBoard(ctx, services.Threads, event.Status, knownBoard)
+	if err != nil {
+		fmt.Println("-> but it can't be matched to a board, so ignoring it:", err)
+		return
+	}
+	fmt.Println("-> and it's about the board", boardID)
+
+	// Send a message to the poll processing goroutine
+	sendPollMessage(ctx, pollChannel, PollMessage{
+		MessageType: NewPoll,
+		Account:     account,
+		UpdateID:    boardID,
+		PollID:      event.Status.Poll.ID,
+		PollURL:     event.Status.URL,
+		PollOptions: event.Status.Poll.Options,
+		ExpiresAt:   event.Status.Poll.ExpiresAt,
+	})
+
+	// Wake up at each check-in. Each poll has its own checks, which end
+	// with its final check, so overlapping polls are all followed.
+	pollID := event.Status.Poll.ID
+	scheduler.schedule(pollCheckKey(account, pollID), serverClock, pollID, event.Status.CreatedAt, event.Status.Poll.ExpiresAt, checkIns, func(check ScheduledCheck) {
+		sendPollMessage(ctx, pollChannel, PollMessage{
+			MessageType: TimerCheck,
+			Account:     account,
+			UpdateID:    boardID,
+			PollID:      pollID,
+			Elapsed:     check.Elapsed,
+			FinalCheck:  check.Final,
+		})
+	})
 
-	status := "I am watching snakebot slithering. The most recent update I saw was "
-	status += event.Status.URL
-	status += "\n\n"
-	status += "This is what I see, in text form:\n\n"
-	status += gridStr
-	status += "\n\n"
-	if mustTurn {
-		status += "It looks like the snake is headed for disaster if it doesn't turn!\n\n"
+	// Look for danger shortly before the poll closes, apart from the
+	// voting checks so that alerts don't change when the bot votes
+	if alerts.Subscribers != nil {
+		scheduler.schedule(alertCheckKey(account, pollID), serverClock, pollID, event.Status.CreatedAt, event.Status.Poll.ExpiresAt, []CheckIn{{Lead: alerts.lead()}}, func(check ScheduledCheck) {
+			sendPollMessage(ctx, pollChannel, PollMessage{
+				MessageType: TimerCheck,
+				Account:     account,
+				UpdateID:    boardID,
+				PollID:      pollID,
+				Elapsed:     check.Elapsed,
+				Alert:       true,
+				ServerClock: serverClock,
+			})
+		})
+	}
+}
+
+// The key of a poll's checks in the scheduler
+func pollCheckKey(account *WatchedAccount, pollID mastodon.ID) string {
+	return account.Acct + " " + string(pollID)
+}
+
+// The key of a poll's alert check in the scheduler
+func alertCheckKey(account *WatchedAccount, pollID mastodon.ID) string {
+	return pollCheckKey(account, pollID) + " alerts"
+}
+
+// Analyse a board and post the analysis. When a board we've already
+// analysed is edited, the analysis post is edited to match instead.
+func handleBoardUpdate(ctx context.Context, services BotServices, config BotConfig, pollChannel chan PollMessage, account *WatchedAccount, analysisPosts *AnalysisPosts, gameThreads *GameThreads, event *mastodon.UpdateEvent, edited bool) error {
+	analysis, err := analyzeAttachment(event.Status.MediaAttachments[0], account.Rules, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("failed to analyze board: %v", err)
+	}
+
+	// Whatever happens to the post, the worker still gets the analysis so
+	// that it can vote, along with the analysis it already has if the
+	// board was edited
+	var myUpdateId mastodon.ID
+	postID, posted := analysisPosts.get(event.Status.ID)
+	if edited && posted {
+		myUpdateId = postID
+	}
+	defer func() {
+		sendPollMessage(ctx, pollChannel, PollMessage{
+			MessageType: NewState,
+			Account:     account,
+			UpdateID:    event.Status.ID,
+			MyVote:      analysis.BestMove,
+			MustTurn:    analysis.MustTurn,
+			MyUpdateId:  myUpdateId,
+			GameState:   analysis.GameState,
+			Moves:       analysis.Moves,
+			Edited:      edited,
+		})
+	}()
+
+	boards := config.Posting.Boards
+	if board, err := boards.Log.RenderBoard(analysis.GameState); err == nil {
+		fmt.Println(board)
+	}
+	// The post goes out without the board rather than with a guess at it
+	board, err := boards.Post.RenderBoard(analysis.GameState)
+	if err != nil {
+		fmt.Println("Failed to draw the board:", err)
 	}
-	status += "I'm not very smart, but I think the snake should move " + move + " next."
 
-	// Post a new message, referring to the original message by its URL
-	post, err := client.PostStatus(context.Background(), &mastodon.Toot{
-		Status: status,
+	status, err := config.Composer.composeAnalysis(PostFields{
+		Board:    board,
+		Move:     analysis.BestMove,
+		Scores:   analysis.Moves,
+		Danger:   analysis.MustTurn,
+		Link:     event.Status.URL,
+		Position: analysis.Position,
 	})
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to compose analysis: %v", err)
+	}
+
+	// The image goes with the post, or the post goes without it
+	var mediaIDs []mastodon.ID
+	if config.Posting.AnalysisImage && services.Media != nil {
+		mediaID, err := uploadAnalysisImage(ctx, services.Media, analysis, boards.AltText)
+		if err != nil {
+			fmt.Println("Failed to upload the analysis image, so posting without it:", err)
+		} else {
+			mediaIDs = append(mediaIDs, mediaID)
+		}
+	}
+
+	if edited && posted && services.Editor != nil {
+		// Bring our analysis up to date with the board
+		fmt.Println("Editing analysis", postID)
+		toot := config.Posting.toot(status, "")
+		toot.MediaIDs = mediaIDs
+		if _, err := services.Editor.EditStatus(ctx, postID, toot); err != nil {
+			return fmt.Errorf("failed to edit analysis: %v", err)
+		}
+		return nil
+	}
+
+	// Respond to the post with the chosen move, threaded as configured
+	inReplyToID := analysisReplyTo(config.Posting, gameThreads, account, event.Status, analysis.GameState)
+	toot := config.Posting.toot(status, inReplyToID)
+	toot.MediaIDs = mediaIDs
+	myUpdateId, err = makePost(services.Publisher, toot)
+	if err != nil {
+		return fmt.Errorf("failed to post analysis: %v", err)
 	}
+	analysisPosts.add(event.Status.ID, myUpdateId)
+	gameThreads.posted(account.Acct, analysis.GameState, myUpdateId)
+	fmt.Println("Post made")
+	return nil
+}
 
-	return post.ID
+func makePost(publisher Publisher, toot *mastodon.Toot) (mastodon.ID, error) {
+	fmt.Println("Making mastodon post")
+
+	post, err := publisher.PostStatus(context.Background(), toot)
+	if err != nil {
+		return "", err
+	}
+	return post.ID, nil
+}
+
+// The composer to use, with the instance's character limit if the
+// instance says what it is, leaving room for the content warning
+func instanceComposer(ctx context.Context, services BotServices, composer *Composer, contentWarning string) *Composer {
+	limited := defaultComposer()
+	if composer != nil {
+		*limited = *composer
+	}
+	limited.ContentWarning = contentWarning
+	if services.Instance == nil {
+		return limited
+	}
+
+	maxCharacters, err := services.Instance.MaxCharacters(ctx)
+	if err != nil {
+		fmt.Println("Couldn't read the instance's character limit, so assuming", limited.MaxCharacters, "characters:", err)
+		return limited
+	}
+	fmt.Println("Posts can be up to", maxCharacters, "characters long")
+	limited.MaxCharacters = maxCharacters
+	return limited
 }
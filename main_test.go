@@ -0,0 +1,1144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// How long the test polls stay open
+const testPollTimeLeft = 30 * time.Minute
+
+var testPollOptions = []string{"Move up", "Move down", "Move left", "Move right"}
+
+// A snake heading right with a wall right in front of it. It must turn up.
+var doomedGame = mustParseBoardDrawing(`
+	.......@
+	........
+	.....+->
+	.....o..
+	........`)
+
+// A snake heading right with plenty of room ahead of it
+var safeGame = mustParseBoardDrawing(`
+	........
+	........
+	.o->..@.
+	........
+	........`)
+
+// Start the bot against a fake server with the default policy, and stop it
+// when the test ends
+func startTestBot(t *testing.T) (*fakeMastodon, *fakeClock) {
+	return startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName)})
+}
+
+func startConfiguredTestBot(t *testing.T, config BotConfig) (*fakeMastodon, *fakeClock) {
+	return startTestBotOn(t, newFakeMastodon(t), config)
+}
+
+// Start the bot against a fake server which the test has already set up
+func startTestBotOn(t *testing.T, fake *fakeMastodon, config BotConfig) (*fakeMastodon, *fakeClock) {
+	clock := newFakeClock(time.Now())
+
+	services := mastodonServices(fake.client())
+	services.Clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go runBot(ctx, services, config)
+	fake.waitForStream()
+
+	return fake, clock
+}
+
+func namedPolicy(t *testing.T, name string) VotePolicy {
+	policy, err := parseVotePolicy(name)
+	if err != nil {
+		t.Fatalf("parseVotePolicy returned error %v", err)
+	}
+	return policy
+}
+
+// Let the bot's poll check come due, and give the bot a moment to act on it
+func advanceToPollCheck(t *testing.T, clock *fakeClock) {
+	clock.waitForTimers(t, 1)
+	clock.Advance(testPollTimeLeft - pollCheckLead)
+	time.Sleep(200 * time.Millisecond)
+}
+
+func TestBotPostsAnalysisOfBoard(t *testing.T) {
+	fake, _ := startTestBot(t)
+
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+
+	posts := fake.waitForPosts(1)
+	if !strings.Contains(posts[0].Content, board.URL) {
+		t.Errorf("post %q doesn't link to the board %s", posts[0].Content, board.URL)
+	}
+	if !strings.Contains(posts[0].Content, "should move right") {
+		t.Errorf("post %q doesn't recommend moving right", posts[0].Content)
+	}
+	if !strings.Contains(posts[0].Content, "v1/8x5/D3l2/G3/r") {
+		t.Errorf("post %q doesn't give the position", posts[0].Content)
+	}
+}
+
+func TestBotVotesWhenNobodyVotedAndSnakeMustTurn(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	posts := fake.waitForPosts(1)
+
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if votes[0].PollID != poll.Poll.ID || len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up) on poll %s", votes[0], poll.Poll.ID)
+	}
+
+	// The vote is announced in reply to the analysis
+	posts = fake.waitForPosts(2)
+	if posts[1].InReplyToID != string(posts[0].ID) {
+		t.Errorf("vote announcement replied to %v, want %v", posts[1].InReplyToID, posts[0].ID)
+	}
+	if !strings.Contains(posts[1].Content, "move up") {
+		t.Errorf("vote announcement %q doesn't mention the move", posts[1].Content)
+	}
+}
+
+func TestBotFallsBackWhenPreferredMoveIsNotOffered(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	// The AI wants to go up, but the poll doesn't offer it
+	poll := fake.snakebotPoll(board, testPollTimeLeft, "Move right", "Move down", "Move left")
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if len(votes[0].Choices) != 1 || votes[0].Choices[0] != 1 {
+		t.Errorf("bot voted %v, want option 1 (down)", votes[0])
+	}
+
+	posts := fake.waitForPosts(2)
+	if !strings.Contains(posts[1].Content, "move down") || !strings.Contains(posts[1].Content, "rather move up") {
+		t.Errorf("vote announcement %q doesn't explain the fallback", posts[1].Content)
+	}
+}
+
+func TestBotVotesOnEmojiPollOptions(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	poll := fake.snakebotPoll(board, testPollTimeLeft, "Keep going", "⬇️", "⬆️")
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if len(votes[0].Choices) != 1 || votes[0].Choices[0] != 2 {
+		t.Errorf("bot voted %v, want option 2 (up)", votes[0])
+	}
+}
+
+func TestBotDoesNotVoteWhenSomeoneVoted(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.setPollVotes(poll.Poll, 0, 1, 0, 0)
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+	if votes := fake.castVotes(); len(votes) != 0 {
+		t.Errorf("bot voted %v, want no votes", votes)
+	}
+}
+
+func TestBotCounterVotesWhenCrowdPicksDeadlyMove(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	// Two people want the snake to keep going right, into the wall
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.setPollVotes(poll.Poll, 0, 0, 0, 2)
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up)", votes[0])
+	}
+
+	posts := fake.waitForPosts(2)
+	if !strings.Contains(posts[1].Content, "crash into the wall") || !strings.Contains(posts[1].Content, "move up") {
+		t.Errorf("vote announcement %q doesn't explain the danger", posts[1].Content)
+	}
+}
+
+func TestBotVotesOnceAcrossCheckIns(t *testing.T) {
+	checkIns, _ := parseCheckIns("50%,90%,98%")
+	fake, clock := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), CheckIns: checkIns})
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	// Somebody has already picked a safe move at the first check-in
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.setPollVotes(poll.Poll, 0, 1, 0, 0)
+	fake.emit(poll)
+	clock.waitForTimers(t, 3)
+	clock.Advance(testPollTimeLeft / 2)
+	time.Sleep(200 * time.Millisecond)
+	if votes := fake.castVotes(); len(votes) != 0 {
+		t.Fatalf("bot voted %v half way through, want no votes", votes)
+	}
+
+	// Late voters pile on to the deadly move, so the bot counter-votes
+	fake.setPollVotes(poll.Poll, 0, 1, 0, 3)
+	clock.Advance(testPollTimeLeft * 4 / 10)
+	votes := fake.waitForVotes(1)
+	if len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up)", votes[0])
+	}
+
+	// It doesn't vote again at the last check-in
+	clock.Advance(testPollTimeLeft / 10)
+	time.Sleep(200 * time.Millisecond)
+	if votes := fake.castVotes(); len(votes) != 1 {
+		t.Errorf("bot voted %d times, want once", len(votes))
+	}
+}
+
+func TestBotVotesAgainWhenAVoteFails(t *testing.T) {
+	checkIns, _ := parseCheckIns("50%,90%")
+	fake := newFakeMastodon(t)
+	fake.rejectVotes = 1
+	fake, clock := startTestBotOn(t, fake, BotConfig{Policy: namedPolicy(t, defaultPolicyName), CheckIns: checkIns})
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	// The server turns the first vote down, and the bot doesn't claim it
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+	clock.waitForTimers(t, 2)
+	clock.Advance(testPollTimeLeft / 2)
+	time.Sleep(200 * time.Millisecond)
+	if posts := fake.postedStatuses(); len(posts) != 1 {
+		t.Errorf("bot posted %d statuses after its vote failed, want only the analysis", len(posts))
+	}
+
+	// It votes at the next check-in instead, and announces that vote
+	clock.Advance(testPollTimeLeft * 4 / 10)
+	votes := fake.waitForVotes(1)
+	if len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up)", votes[0])
+	}
+	posts := fake.waitForPosts(2)
+	if !strings.Contains(posts[1].Content, "move up") {
+		t.Errorf("vote announcement %q doesn't mention the move", posts[1].Content)
+	}
+}
+
+func TestBotDoesNotVoteWhenSnakeIsSafe(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+	if votes := fake.castVotes(); len(votes) != 0 {
+		t.Errorf("bot voted %v, want no votes", votes)
+	}
+}
+
+func TestBotHandlesPollBeforeBoard(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	board := fake.snakebotBoard(doomedGame)
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+
+	// The poll arrives before the board it belongs to
+	fake.emit(poll)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	// The analysis reaches the worker just after it's posted
+	time.Sleep(100 * time.Millisecond)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if votes[0].PollID != poll.Poll.ID || len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up) on poll %s", votes[0], poll.Poll.ID)
+	}
+}
+
+func TestBotMatchesPollsToBoardsByReply(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	// Two boards arrive before the poll for the first one
+	doomedBoard := fake.snakebotBoard(doomedGame)
+	safeBoard := fake.snakebotBoard(safeGame)
+	fake.emit(doomedBoard)
+	fake.emit(safeBoard)
+	fake.waitForPosts(2)
+
+	poll := fake.snakebotPoll(doomedBoard, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+
+	// The bot votes using the analysis of the board the poll replies to
+	votes := fake.waitForVotes(1)
+	if votes[0].PollID != poll.Poll.ID || len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up) on poll %s", votes[0], poll.Poll.ID)
+	}
+}
+
+func TestBotFindsBoardsFurtherUpThePollsThread(t *testing.T) {
+	fake, clock := startTestBot(t)
+
+	// Snakebot says something about the board before asking for votes,
+	// so the poll replies to that instead of the board
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+	note := fake.snakebotReply(board, "<p>Things are getting tight</p>")
+	fake.emit(note)
+
+	poll := fake.snakebotPoll(note, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if votes[0].PollID != poll.Poll.ID || len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up) on poll %s", votes[0], poll.Poll.ID)
+	}
+}
+
+func TestBotWatchesConfiguredAccounts(t *testing.T) {
+	clone := &WatchedAccount{Acct: "snek@example.com", Rules: defaultAccountRules()}
+	clone.Rules.OptionWords = map[string]string{"hoch": "up", "runter": "down", "weiter": "straight"}
+	accounts := append(defaultWatchedAccounts(), clone)
+	fake, clock := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), Accounts: accounts})
+
+	board := fake.snakebotBoard(doomedGame)
+	board.Account = mastodon.Account{ID: "4", Username: "snek", Acct: "snek@example.com"}
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	poll := fake.snakebotPoll(board, testPollTimeLeft, "Weiter", "Runter", "Hoch")
+	poll.Account = board.Account
+	fake.emit(poll)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if len(votes[0].Choices) != 1 || votes[0].Choices[0] != 2 {
+		t.Errorf("bot voted %v, want option 2 (up)", votes[0])
+	}
+}
+
+func TestBotIgnoresRepeatedStatuses(t *testing.T) {
+	fake, _ := startTestBot(t)
+
+	// The stream delivers the same board twice, as it can after reconnecting
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	time.Sleep(200 * time.Millisecond)
+	if len(fake.postedStatuses()) != 1 {
+		t.Errorf("bot posted %d statuses, want 1", len(fake.postedStatuses()))
+	}
+}
+
+func TestBotIgnoresBoosts(t *testing.T) {
+	fake, _ := startTestBot(t)
+
+	// Snakebot boosts one of its own boards
+	board := fake.snakebotBoard(safeGame)
+	boost := &mastodon.Status{
+		ID:      "boost-" + board.ID,
+		Account: fakeSnakebotAccount,
+		Reblog:  board,
+	}
+	fake.emit(boost)
+
+	time.Sleep(200 * time.Millisecond)
+	if len(fake.postedStatuses()) != 0 {
+		t.Errorf("bot posted %d statuses, want none", len(fake.postedStatuses()))
+	}
+}
+
+func TestBotEditsAnalysisWhenBoardIsEdited(t *testing.T) {
+	fake, _ := startTestBot(t)
+
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	// Snakebot fixes the board, swapping in a different image
+	edited := *board
+	edited.MediaAttachments = fake.snakebotBoard(doomedGame).MediaAttachments
+	fake.emitEdit(&edited)
+
+	edits := fake.waitForEdits(1)
+	if !strings.Contains(edits[0].Content, "should move up") {
+		t.Errorf("edited analysis %q doesn't recommend moving up", edits[0].Content)
+	}
+	if len(fake.postedStatuses()) != 1 {
+		t.Errorf("bot posted %d statuses, want 1", len(fake.postedStatuses()))
+	}
+}
+
+func TestBotRepliesToBoards(t *testing.T) {
+	posting := PostingConfig{Threading: ThreadReply, Visibility: VisibilityUnlisted, ContentWarning: "Snake spoilers"}
+	fake, _ := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), Posting: posting})
+
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+
+	posts := fake.waitForPosts(1)
+	if posts[0].InReplyToID != string(board.ID) {
+		t.Errorf("analysis replied to %v, want the board %v", posts[0].InReplyToID, board.ID)
+	}
+	if posts[0].Visibility != VisibilityUnlisted || posts[0].SpoilerText != "Snake spoilers" {
+		t.Errorf("analysis posted with visibility %q and content warning %q, want unlisted with the content warning", posts[0].Visibility, posts[0].SpoilerText)
+	}
+}
+
+func TestBotThreadsAnalysesByGame(t *testing.T) {
+	posting := PostingConfig{Threading: ThreadGame}
+	fake, _ := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), Posting: posting})
+
+	// Two boards from one game, then the first board of a new game, whose
+	// snake is shorter
+	fake.emit(fake.snakebotBoard(doomedGame))
+	fake.waitForPosts(1)
+	fake.emit(fake.snakebotBoard(doomedGame))
+	fake.waitForPosts(2)
+	fake.emit(fake.snakebotBoard(safeGame))
+
+	posts := fake.waitForPosts(3)
+	if posts[0].InReplyToID != nil {
+		t.Errorf("first analysis replied to %v, want a new thread", posts[0].InReplyToID)
+	}
+	if posts[1].InReplyToID != string(posts[0].ID) {
+		t.Errorf("second analysis replied to %v, want the first analysis %v", posts[1].InReplyToID, posts[0].ID)
+	}
+	if posts[2].InReplyToID != nil {
+		t.Errorf("analysis of the new game replied to %v, want a new thread", posts[2].InReplyToID)
+	}
+}
+
+func TestBotFitsPostsInTheInstanceLimit(t *testing.T) {
+	fake := newFakeMastodon(t)
+	fake.maxCharacters = 200
+	fake, _ = startTestBotOn(t, fake, BotConfig{Policy: namedPolicy(t, defaultPolicyName)})
+
+	fake.emit(fake.snakebotBoard(doomedGame))
+
+	posts := fake.waitForPosts(1)
+	if length := statusLength(posts[0].Content); length > 200 {
+		t.Errorf("analysis is %d characters long, want at most 200", length)
+	}
+	if strings.Contains(posts[0].Content, "┌") {
+		t.Errorf("analysis %q still has the board in it", posts[0].Content)
+	}
+	if !strings.Contains(posts[0].Content, "should move up") {
+		t.Errorf("analysis %q doesn't recommend moving up", posts[0].Content)
+	}
+}
+
+func TestBotVotesWhenItsAnalysisIsRejected(t *testing.T) {
+	fake := newFakeMastodon(t)
+	fake.rejectPosts = true
+	fake, clock := startTestBotOn(t, fake, BotConfig{Policy: namedPolicy(t, defaultPolicyName)})
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+
+	// The analysis reaches the worker after the post fails
+	time.Sleep(100 * time.Millisecond)
+	advanceToPollCheck(t, clock)
+
+	votes := fake.waitForVotes(1)
+	if votes[0].PollID != poll.Poll.ID || len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up) on poll %s", votes[0], poll.Poll.ID)
+	}
+}
+
+func TestBotAttachesAnalysisImage(t *testing.T) {
+	posting := PostingConfig{AnalysisImage: true}
+	fake, _ := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), Posting: posting})
+
+	fake.emit(fake.snakebotBoard(doomedGame))
+
+	posts := fake.waitForPosts(1)
+	if len(posts[0].MediaAttachments) != 1 {
+		t.Fatalf("analysis has %d attachments, want 1", len(posts[0].MediaAttachments))
+	}
+	alt := posts[0].MediaAttachments[0].Description
+	for _, want := range []string{"Head at H3 facing right", "food at H1", "points up"} {
+		if !strings.Contains(alt, want) {
+			t.Errorf("alt text %q doesn't say %q", alt, want)
+		}
+	}
+}
+
+func TestBotAnswersPuzzles(t *testing.T) {
+	puzzles := PuzzleConfig{Enabled: true}
+	fake, _ := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), Puzzles: puzzles})
+
+	// One puzzle as a position, one as a board image
+	byPosition := fake.mention(fakeFollowerAccount, "what would you do in v1/8x5/H3l2d/H1/r?", nil, "public")
+	posts := fake.waitForPosts(1)
+	byImage := fake.mention(fakeFollowerAccount, "and here?", &safeGame, "direct")
+	posts = fake.waitForPosts(2)
+
+	tests := []struct {
+		mention    *mastodon.Status
+		want       []string
+		visibility string
+	}{
+		{byPosition, []string{"@follower@example.com", "I'd move up", "right: ", "deadly: the snake would", "v1/8x5/H3l2d/H1/r"}, ""},
+		{byImage, []string{"@follower@example.com", "I'd move right", "v1/8x5/D3l2/G3/r"}, "direct"},
+	}
+	for idx, test := range tests {
+		post := posts[idx]
+		if post.InReplyToID != string(test.mention.ID) {
+			t.Errorf("answer is in reply to %v, want the mention %s", post.InReplyToID, test.mention.ID)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(post.Content, want) {
+				t.Errorf("answer %q doesn't say %q", post.Content, want)
+			}
+		}
+		if post.Visibility != test.visibility {
+			t.Errorf("answer has visibility %q, want %q", post.Visibility, test.visibility)
+		}
+		if len(post.MediaAttachments) != 1 {
+			t.Errorf("answer has %d attachments, want the analysis image", len(post.MediaAttachments))
+		}
+	}
+}
+
+func TestBotExplainsPuzzlesItCantRead(t *testing.T) {
+	puzzles := PuzzleConfig{Enabled: true}
+	fake, _ := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), Puzzles: puzzles})
+
+	fake.mention(fakeFollowerAccount, "v1/8x5/H3l2d/H3/r", nil, "public")
+
+	posts := fake.waitForPosts(1)
+	if !strings.Contains(posts[0].Content, "couldn't read that board: "+puzzleFailureReason) {
+		t.Errorf("answer %q doesn't say the board couldn't be read", posts[0].Content)
+	}
+	if strings.Contains(posts[0].Content, "snake segment") {
+		t.Errorf("answer %q gives away the error", posts[0].Content)
+	}
+}
+
+func TestBotRateLimitsPuzzles(t *testing.T) {
+	puzzles := PuzzleConfig{Enabled: true, Limit: 1, Window: time.Hour}
+	fake, clock := startConfiguredTestBot(t, BotConfig{Policy: namedPolicy(t, defaultPolicyName), Puzzles: puzzles})
+
+	first := fake.mention(fakeFollowerAccount, "v1/8x5/H3l2d/H1/r", nil, "public")
+	fake.waitForPosts(1)
+
+	// Over the limit, and with no puzzle at all, so both are ignored
+	fake.mention(fakeFollowerAccount, "v1/8x5/D3l2/G3/r", nil, "public")
+	fake.mention(fakeSnakebotAccount, "thanks for watching!", nil, "public")
+	time.Sleep(200 * time.Millisecond)
+
+	// A new hour, and a new puzzle
+	clock.Advance(time.Hour)
+	last := fake.mention(fakeFollowerAccount, "v1/8x5/D3l2/G3/r", nil, "public")
+
+	fake.waitForPosts(2)
+	time.Sleep(200 * time.Millisecond)
+	posts := fake.postedStatuses()
+	if len(posts) != 2 {
+		t.Fatalf("bot answered %d puzzles, want 2", len(posts))
+	}
+	if posts[0].InReplyToID != string(first.ID) || posts[1].InReplyToID != string(last.ID) {
+		t.Errorf("bot answered %v and %v, want %s and %s", posts[0].InReplyToID, posts[1].InReplyToID, first.ID, last.ID)
+	}
+}
+
+func TestBotIgnoresPuzzlesWhenTurnedOff(t *testing.T) {
+	fake, _ := startTestBot(t)
+
+	fake.mention(fakeFollowerAccount, "v1/8x5/H3l2d/H1/r", nil, "public")
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+
+	fake.waitForPosts(1)
+	time.Sleep(200 * time.Millisecond)
+	posts := fake.postedStatuses()
+	if len(posts) != 1 || !strings.Contains(posts[0].Content, board.URL) {
+		t.Errorf("bot posted %d statuses, want just the analysis of the board", len(posts))
+	}
+}
+
+// Start the bot taking commands from the follower, with an audit log
+func startAdminTestBot(t *testing.T, config BotConfig) (*fakeMastodon, *fakeClock, string) {
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(auditFile)
+	if err != nil {
+		t.Fatalf("openAuditLog returned error %v", err)
+	}
+	config.Policy = namedPolicy(t, defaultPolicyName)
+	config.Admins = []string{fakeFollowerAccount.Acct}
+	config.Audit = audit
+	fake, clock := startConfiguredTestBot(t, config)
+	return fake, clock, auditFile
+}
+
+// Send the bot a command and wait for its acknowledgement
+func sendCommand(t *testing.T, fake *fakeMastodon, command string) *mastodon.Status {
+	t.Helper()
+	before := len(fake.postedStatuses())
+	dm := fake.mention(fakeFollowerAccount, command, nil, "direct")
+	posts := fake.waitForPosts(before + 1)
+	reply := posts[len(posts)-1]
+	if reply.InReplyToID != string(dm.ID) || reply.Visibility != "direct" {
+		t.Errorf("reply to %q is %v in reply to %v, want a direct reply to %s", command, reply.Visibility, reply.InReplyToID, dm.ID)
+	}
+	return reply
+}
+
+func TestBotPausesVotingOnCommand(t *testing.T) {
+	// The poll is checked half way through and near the end
+	checkIns, err := parseCheckIns("50%,90%")
+	if err != nil {
+		t.Fatalf("parseCheckIns returned error %v", err)
+	}
+	fake, clock, auditFile := startAdminTestBot(t, BotConfig{CheckIns: checkIns})
+
+	if reply := sendCommand(t, fake, "pause voting"); !strings.Contains(reply.Content, "Voting paused") {
+		t.Errorf("reply %q doesn't say voting is paused", reply.Content)
+	}
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(2)
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+	clock.waitForTimers(t, 2)
+
+	status := sendCommand(t, fake, "status")
+	for _, want := range []string{"Voting paused", "board " + string(board.ID), "would move up, watching poll " + string(poll.Poll.ID), "Checking poll " + string(poll.Poll.ID)} {
+		if !strings.Contains(status.Content, want) {
+			t.Errorf("status %q doesn't say %q", status.Content, want)
+		}
+	}
+
+	clock.Advance(testPollTimeLeft / 2)
+	time.Sleep(200 * time.Millisecond)
+	if votes := fake.castVotes(); len(votes) != 0 {
+		t.Errorf("bot voted %v while voting was paused", votes)
+	}
+
+	// Once it's resumed, the bot votes at the next check
+	sendCommand(t, fake, "resume")
+	clock.Advance(testPollTimeLeft * 2 / 5)
+	votes := fake.waitForVotes(1)
+	if votes[0].PollID != poll.Poll.ID {
+		t.Errorf("bot voted on poll %s, want %s", votes[0].PollID, poll.Poll.ID)
+	}
+
+	// Every command is in the audit log
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatalf("failed to read the audit log: %v", err)
+	}
+	commands := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("audit log line %q isn't a record: %v", line, err)
+		}
+		if record.Admin != fakeFollowerAccount.Acct || !record.OK || record.StatusID == "" {
+			t.Errorf("audit record %v, want a successful command from %s", record, fakeFollowerAccount.Acct)
+		}
+		commands = append(commands, record.Command)
+	}
+	if strings.Join(commands, ", ") != "pause voting, status, resume" {
+		t.Errorf("audit log has commands %q, want pause voting, status and resume", commands)
+	}
+}
+
+func TestBotChangesStrategyAndDryRunOnCommand(t *testing.T) {
+	fake, clock, _ := startAdminTestBot(t, BotConfig{})
+
+	// Nothing but acknowledgements goes out during a dry run
+	sendCommand(t, fake, "dry-run on")
+	fake.emit(fake.snakebotBoard(safeGame))
+	time.Sleep(200 * time.Millisecond)
+	if posts := fake.postedStatuses(); len(posts) != 1 {
+		t.Errorf("bot made %d posts during a dry run, want just the acknowledgement", len(posts))
+	}
+	sendCommand(t, fake, "dry-run off")
+
+	if reply := sendCommand(t, fake, "strategy sometimes"); !strings.Contains(reply.Content, "unknown") {
+		t.Errorf("reply %q doesn't say the policy is unknown", reply.Content)
+	}
+	if reply := sendCommand(t, fake, "strategy never"); !strings.Contains(reply.Content, "policy never") {
+		t.Errorf("reply %q doesn't say the policy changed", reply.Content)
+	}
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(5)
+	fake.emit(fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...))
+	advanceToPollCheck(t, clock)
+	if votes := fake.castVotes(); len(votes) != 0 {
+		t.Errorf("bot voted %v with the policy never", votes)
+	}
+}
+
+func TestBotVotesForRealAfterADryRun(t *testing.T) {
+	checkIns, _ := parseCheckIns("50%,90%")
+	fake, clock, _ := startAdminTestBot(t, BotConfig{CheckIns: checkIns})
+
+	// The dry run doesn't vote at the first check-in, or say that it did
+	sendCommand(t, fake, "dry-run on")
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.emit(fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...))
+	clock.waitForTimers(t, 2)
+	clock.Advance(testPollTimeLeft / 2)
+	time.Sleep(200 * time.Millisecond)
+	if votes := fake.castVotes(); len(votes) != 0 {
+		t.Errorf("bot voted %v during a dry run", votes)
+	}
+
+	// Once it's over, the bot votes at the next check-in
+	sendCommand(t, fake, "dry-run off")
+	clock.Advance(testPollTimeLeft * 4 / 10)
+	votes := fake.waitForVotes(1)
+	if len(votes[0].Choices) != 1 || votes[0].Choices[0] != 0 {
+		t.Errorf("bot voted %v, want option 0 (up)", votes[0])
+	}
+}
+
+func TestBotReanalysesBoardsOnCommand(t *testing.T) {
+	fake, _, _ := startAdminTestBot(t, BotConfig{})
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	analysis := fake.waitForPosts(1)[0]
+
+	reply := sendCommand(t, fake, "reanalyse "+board.URL)
+	if !strings.Contains(reply.Content, "Analysed board "+string(board.ID)) {
+		t.Errorf("reply %q doesn't say the board was analysed again", reply.Content)
+	}
+	edits := fake.waitForEdits(1)
+	if edits[0].ID != analysis.ID {
+		t.Errorf("bot edited %s, want its analysis %s", edits[0].ID, analysis.ID)
+	}
+
+	if reply := sendCommand(t, fake, "reanalyse "+fake.server.URL+"/@snake_game/1234"); !strings.Contains(reply.Content, "couldn't find a status") {
+		t.Errorf("reply %q doesn't say the status wasn't found", reply.Content)
+	}
+}
+
+func TestBotOnlyTakesCommandsFromAdminsInDirectMessages(t *testing.T) {
+	fake, clock, _ := startAdminTestBot(t, BotConfig{})
+
+	fake.mention(fakeSnakebotAccount, "pause voting", nil, "direct")
+	fake.mention(fakeFollowerAccount, "pause voting", nil, "public")
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+	fake.emit(fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...))
+	advanceToPollCheck(t, clock)
+
+	fake.waitForVotes(1)
+	for _, post := range fake.postedStatuses() {
+		if post.Visibility == "direct" {
+			t.Errorf("bot replied %q to a command it shouldn't take", post.Content)
+		}
+	}
+}
+
+// Start the bot with danger alerts this long before each poll closes,
+// keeping the subscribers in a file in the test's directory
+func startAlertTestBot(t *testing.T, lead time.Duration) (*fakeMastodon, *fakeClock, string) {
+	subscribersFile := filepath.Join(t.TempDir(), "subscribers.json")
+	store, err := openSubscriberStore(subscribersFile)
+	if err != nil {
+		t.Fatalf("openSubscriberStore returned error %v", err)
+	}
+	fake, clock := startConfiguredTestBot(t, BotConfig{
+		Policy: namedPolicy(t, defaultPolicyName),
+		Alerts: AlertConfig{Subscribers: store, Lead: lead, Interval: time.Hour},
+	})
+	return fake, clock, subscribersFile
+}
+
+// The danger alerts the bot has sent
+func sentAlerts(fake *fakeMastodon) []*mastodon.Status {
+	alerts := []*mastodon.Status{}
+	for _, status := range fake.postedStatuses() {
+		if strings.Contains(status.Content, "in danger") {
+			alerts = append(alerts, status)
+		}
+	}
+	return alerts
+}
+
+func TestBotAlertsSubscribersWhenTheSnakeIsInDanger(t *testing.T) {
+	fake, clock, subscribersFile := startAlertTestBot(t, testPollTimeLeft/4)
+
+	dm := fake.mention(fakeFollowerAccount, "subscribe", nil, "direct")
+	reply := fake.waitForPosts(1)[0]
+	if reply.InReplyToID != string(dm.ID) || reply.Visibility != "direct" || !strings.Contains(reply.Content, "You're subscribed") {
+		t.Errorf("bot answered %q with %v %q in reply to %v, want a direct reply saying they're subscribed", "subscribe", reply.Visibility, reply.Content, reply.InReplyToID)
+	}
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(2)
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.emit(poll)
+	clock.waitForTimers(t, 2)
+
+	// The alert goes out when a quarter of the poll is left, before the bot
+	// votes
+	clock.Advance(testPollTimeLeft * 3 / 4)
+	fake.waitForPosts(3)
+	alerts := sentAlerts(fake)
+	if len(alerts) != 1 {
+		t.Fatalf("bot sent %d alerts, want 1", len(alerts))
+	}
+	alert := alerts[0]
+	for _, want := range []string{"@" + fakeFollowerAccount.Acct, "crashes if it keeps going right", poll.URL} {
+		if !strings.Contains(alert.Content, want) {
+			t.Errorf("alert %q doesn't say %q", alert.Content, want)
+		}
+	}
+	if alert.Visibility != "direct" {
+		t.Errorf("alert has visibility %q, want direct", alert.Visibility)
+	}
+	if votes := fake.castVotes(); len(votes) != 0 {
+		t.Errorf("bot voted %v at the alert check", votes)
+	}
+
+	// The subscription and its last alert are saved, once the alert has
+	// gone out
+	var due []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		store, err := openSubscriberStore(subscribersFile)
+		if err != nil {
+			t.Fatalf("openSubscriberStore returned error %v", err)
+		}
+		if due = store.due(clock.Now(), time.Hour); len(due) == 0 {
+			break
+		}
+	}
+	if len(due) != 0 {
+		t.Errorf("saved subscribers due another alert are %v, want nobody", due)
+	}
+
+	// The bot still votes at its own check
+	clock.Advance(testPollTimeLeft / 4)
+	fake.waitForVotes(1)
+
+	// Another doomed game within the hour doesn't alert the subscriber again
+	board = fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(5)
+	fake.emit(fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...))
+	clock.waitForTimers(t, 2)
+	clock.Advance(testPollTimeLeft * 3 / 4)
+	time.Sleep(200 * time.Millisecond)
+	if alerts := sentAlerts(fake); len(alerts) != 1 {
+		t.Errorf("bot sent %d alerts within the hour, want 1", len(alerts))
+	}
+
+	dm = fake.mention(fakeFollowerAccount, "unsubscribe", nil, "direct")
+	posts := fake.waitForPosts(6)
+	if reply := posts[5]; reply.InReplyToID != string(dm.ID) || !strings.Contains(reply.Content, "You're unsubscribed") {
+		t.Errorf("bot answered %q with %q in reply to %v, want a reply saying they're unsubscribed", "unsubscribe", reply.Content, reply.InReplyToID)
+	}
+}
+
+func TestBotDoesntAlertWhenTheSnakeIsSafe(t *testing.T) {
+	fake, clock, _ := startAlertTestBot(t, testPollTimeLeft/4)
+	fake.mention(fakeFollowerAccount, "subscribe", nil, "direct")
+	fake.waitForPosts(1)
+
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+	fake.waitForPosts(2)
+	fake.emit(fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...))
+	clock.waitForTimers(t, 2)
+
+	clock.Advance(testPollTimeLeft * 3 / 4)
+	time.Sleep(200 * time.Millisecond)
+	if alerts := sentAlerts(fake); len(alerts) != 0 {
+		t.Errorf("bot sent alerts %v about a safe snake", alerts)
+	}
+}
+
+func TestBotAlertsAgainWhenAnAlertFails(t *testing.T) {
+	fake, clock, subscribersFile := startAlertTestBot(t, testPollTimeLeft/4)
+	fake.mention(fakeFollowerAccount, "subscribe", nil, "direct")
+	fake.waitForPosts(1)
+
+	board := fake.snakebotBoard(doomedGame)
+	fake.emit(board)
+	fake.waitForPosts(2)
+	fake.emit(fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...))
+	clock.waitForTimers(t, 2)
+
+	// The server turns the alert down
+	fake.mutex.Lock()
+	fake.rejectPosts = true
+	fake.mutex.Unlock()
+	clock.Advance(testPollTimeLeft * 3 / 4)
+	time.Sleep(200 * time.Millisecond)
+
+	// so the subscriber is still due one
+	store, err := openSubscriberStore(subscribersFile)
+	if err != nil {
+		t.Fatalf("openSubscriberStore returned error %v", err)
+	}
+	if due := store.due(clock.Now(), time.Hour); len(due) != 1 {
+		t.Errorf("subscribers due an alert after it failed are %v, want the subscriber", due)
+	}
+}
+
+func TestBotAlertsAfterTheLastVotingCheck(t *testing.T) {
+	// The alert comes a minute before the poll closes, after the voting
+	// check two minutes before
+	fake, clock, _ := startAlertTestBot(t, time.Minute)
+	fake.mention(fakeFollowerAccount, "subscribe", nil, "direct")
+	fake.waitForPosts(1)
+
+	// The server's clock is five minutes behind ours
+	board := fake.snakebotBoard(doomedGame)
+	poll := fake.snakebotPoll(board, testPollTimeLeft, testPollOptions...)
+	fake.mutex.Lock()
+	board.CreatedAt = board.CreatedAt.Add(-5 * time.Minute)
+	poll.CreatedAt = poll.CreatedAt.Add(-5 * time.Minute)
+	poll.Poll.ExpiresAt = poll.Poll.ExpiresAt.Add(-5 * time.Minute)
+	fake.mutex.Unlock()
+
+	fake.emit(board)
+	fake.waitForPosts(2)
+	fake.emit(poll)
+	clock.waitForTimers(t, 2)
+
+	// The poll lasts as long by the server's clock as by ours
+	clock.Advance(testPollTimeLeft - pollCheckLead + time.Second)
+	fake.waitForVotes(1)
+	clock.Advance(pollCheckLead - time.Minute)
+	fake.waitForPosts(4)
+
+	// The time left is by the server's clock
+	alerts := sentAlerts(fake)
+	if len(alerts) != 1 {
+		t.Fatalf("bot sent %d alerts, want 1", len(alerts))
+	}
+	if !strings.Contains(alerts[0].Content, "closes in a minute") {
+		t.Errorf("alert %q doesn't say the poll closes in a minute", alerts[0].Content)
+	}
+}
+
+func TestBotRateLimitsSubscriptionCommands(t *testing.T) {
+	fake, _, _ := startAlertTestBot(t, testPollTimeLeft/4)
+
+	// Only the first few commands in the hour are answered
+	for idx := 0; idx < subscriptionLimit+2; idx++ {
+		command := "subscribe"
+		if idx%2 == 1 {
+			command = "unsubscribe"
+		}
+		fake.mention(fakeFollowerAccount, command, nil, "direct")
+	}
+	fake.waitForPosts(subscriptionLimit)
+	time.Sleep(200 * time.Millisecond)
+	if posts := fake.postedStatuses(); len(posts) != subscriptionLimit {
+		t.Errorf("bot answered %d subscription commands, want %d", len(posts), subscriptionLimit)
+	}
+}
+
+func TestBotSurvivesMalformedEvents(t *testing.T) {
+	fake, _ := startTestBot(t)
+
+	// An event that isn't JSON
+	fake.emitRaw("update", "{not json")
+
+	// A board whose image can't be downloaded
+	broken := fake.snakebotBoard(safeGame)
+	broken.MediaAttachments[0].URL = fake.server.URL + "/media/missing.png"
+	fake.emit(broken)
+
+	// A status from somebody else
+	other := fake.snakebotBoard(doomedGame)
+	other.Account = mastodon.Account{ID: "3", Username: "someone", Acct: "someone@example.com"}
+	fake.emit(other)
+
+	// The bot still analyses the next board
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+
+	posts := fake.waitForPosts(1)
+	if !strings.Contains(posts[0].Content, board.URL) {
+		t.Errorf("post %q doesn't link to the board %s", posts[0].Content, board.URL)
+	}
+	if len(fake.postedStatuses()) != 1 {
+		t.Errorf("bot posted %d statuses, want 1", len(fake.postedStatuses()))
+	}
+}
+
+// Start the bot with an input mode which polls snakebot's statuses every
+// minute
+func startPollingTestBot(t *testing.T, input string) (*fakeMastodon, *fakeClock) {
+	fake := newFakeMastodon(t)
+	clock := newFakeClock(time.Now())
+
+	services := mastodonServices(fake.client())
+	services.Clock = clock
+	poller := AccountPoller{Client: fake.client(), Accounts: defaultWatchedAccounts(), Interval: time.Minute, Clock: clock}
+	services.Events = inputEvents(input, services.Events, poller)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go runBot(ctx, services, BotConfig{Policy: namedPolicy(t, defaultPolicyName)})
+	if input != InputPoll {
+		fake.waitForStream()
+	}
+	clock.waitForTimers(t, 1)
+
+	return fake, clock
+}
+
+func TestBotPollsAccountStatuses(t *testing.T) {
+	fake, clock := startPollingTestBot(t, InputPoll)
+
+	board := fake.snakebotBoard(safeGame)
+	fake.publish(board)
+	clock.Advance(time.Minute)
+
+	posts := fake.waitForPosts(1)
+	if !strings.Contains(posts[0].Content, board.URL) {
+		t.Errorf("post %q doesn't link to the board %s", posts[0].Content, board.URL)
+	}
+
+	// The board isn't picked up again on the next poll
+	clock.waitForTimers(t, 1)
+	clock.Advance(time.Minute)
+	time.Sleep(200 * time.Millisecond)
+	if len(fake.postedStatuses()) != 1 {
+		t.Errorf("bot posted %d statuses, want 1", len(fake.postedStatuses()))
+	}
+}
+
+func TestBotDedupesStreamAndPolling(t *testing.T) {
+	fake, clock := startPollingTestBot(t, InputBoth)
+
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+	fake.waitForPosts(1)
+
+	// Polling finds the board the stream already delivered
+	clock.Advance(time.Minute)
+	time.Sleep(200 * time.Millisecond)
+	if len(fake.postedStatuses()) != 1 {
+		t.Errorf("bot posted %d statuses, want 1", len(fake.postedStatuses()))
+	}
+}
+
+func TestFakeMastodonWebsocketStream(t *testing.T) {
+	fake := newFakeMastodon(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := fake.client().NewWSClient().StreamingWSUser(ctx)
+	if err != nil {
+		t.Fatalf("StreamingWSUser returned error %v", err)
+	}
+	fake.waitForStream()
+
+	board := fake.snakebotBoard(safeGame)
+	go fake.emit(board)
+
+	for event := range stream {
+		if update, ok := event.(*mastodon.UpdateEvent); ok {
+			if update.Status.ID != board.ID {
+				t.Errorf("websocket stream delivered status %v, want %v", update.Status.ID, board.ID)
+			}
+			return
+		}
+	}
+	t.Errorf("websocket stream closed without delivering the status")
+}
+
+// Collects the bot's posts without a server
+type recordingPublisher struct {
+	toots []*mastodon.Toot
+}
+
+func (p *recordingPublisher) PostStatus(ctx context.Context, toot *mastodon.Toot) (*mastodon.Status, error) {
+	p.toots = append(p.toots, toot)
+	return &mastodon.Status{ID: mastodon.ID("posted")}, nil
+}
+
+func TestBotRunsOnArchivedEvents(t *testing.T) {
+	fake := newFakeMastodon(t)
+	board := fake.snakebotBoard(safeGame)
+
+	publisher := &recordingPublisher{}
+	services := BotServices{
+		Events:    ArchiveEvents{Records: []ArchiveRecord{{Kind: ArchiveStatus, Status: board}}},
+		Publisher: publisher,
+		Polls:     fake.client(),
+		Voter:     PollVoter{Client: fake.client()},
+		Clock:     realClock{},
+	}
+
+	// The bot stops at the end of the archive
+	if err := runBot(context.Background(), services, BotConfig{Policy: VotePolicy{Condition: neverCondition{}}}); err != nil {
+		t.Fatalf("runBot returned error %v", err)
+	}
+
+	if len(publisher.toots) != 1 || !strings.Contains(publisher.toots[0].Status, board.URL) {
+		t.Errorf("bot posted %v, want one analysis of %s", publisher.toots, board.URL)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A position written on one line, for posts, bug reports and archives:
+//
+//	v1/8x5/H3l2d/H1/r
+//
+// The fields are the version of the notation, the board size, the snake,
+// the food and the way the snake is heading. The snake is the square of its
+// head followed by the steps from each segment to the next one towards the
+// tail: u, d, l or r, with a count when a step repeats. Squares are named by
+// squareName, as in the prose board style. A snake heading nowhere in
+// particular has a - for its direction.
+
+// The version of the notation written by encodePosition. Positions written
+// in a version this code doesn't know about are rejected rather than
+// misread.
+const positionNotationVersion = 1
+
+var positionSteps = map[byte]Adjacencies{'u': Up, 'd': Down, 'l': Left, 'r': Right}
+
+var positionDirections = map[string]string{"up": "u", "down": "d", "left": "l", "right": "r", "": "-"}
+
+var (
+	positionVersionPattern = regexp.MustCompile(`^v(\d+)$`)
+	positionSizePattern    = regexp.MustCompile(`^(\d+)x(\d+)$`)
+	positionSquarePattern  = regexp.MustCompile(`^([A-Z]+)([1-9]\d*)`)
+	positionStepPattern    = regexp.MustCompile(`^([udlr])(\d*)`)
+)
+
+// Write a game state in the notation
+func encodePosition(game GameState) (string, error) {
+	if err := game.Validate(); err != nil {
+		return "", err
+	}
+	snake := squareName(game.SnakeShape[0])
+	for idx := 1; idx < len(game.SnakeShape); {
+		step := adjacencyTowards(game.SnakeShape[idx-1], game.SnakeShape[idx])
+		count := 1
+		for idx+count < len(game.SnakeShape) && adjacencyTowards(game.SnakeShape[idx+count-1], game.SnakeShape[idx+count]) == step {
+			count++
+		}
+		snake += string(sideDirections[step][0])
+		if count > 1 {
+			snake += strconv.Itoa(count)
+		}
+		idx += count
+	}
+
+	return fmt.Sprintf("v%d/%dx%d/%s/%s/%s", positionNotationVersion, game.BoardWidth, game.BoardHeight, snake, squareName(game.Food), positionDirections[game.Direction]), nil
+}
+
+// Read a game state written in the notation
+func decodePosition(text string) (GameState, error) {
+	fields := strings.Split(strings.TrimSpace(text), "/")
+
+	match := positionVersionPattern.FindStringSubmatch(fields[0])
+	if match == nil {
+		return GameState{}, fmt.Errorf("position %q doesn't start with a version such as v%d", text, positionNotationVersion)
+	}
+	if version, err := strconv.Atoi(match[1]); err != nil || version != positionNotationVersion {
+		return GameState{}, fmt.Errorf("position notation version %s isn't supported, only v%d", match[1], positionNotationVersion)
+	}
+	if len(fields) != 5 {
+		return GameState{}, fmt.Errorf("position %q has %d fields, want 5", text, len(fields))
+	}
+
+	var game GameState
+	match = positionSizePattern.FindStringSubmatch(fields[1])
+	if match == nil {
+		return GameState{}, fmt.Errorf("board size %q should be WIDTHxHEIGHT", fields[1])
+	}
+	game.BoardWidth, _ = strconv.Atoi(match[1])
+	game.BoardHeight, _ = strconv.Atoi(match[2])
+	if game.BoardWidth < 1 || game.BoardHeight < 1 || game.BoardWidth > maxBoardSide || game.BoardHeight > maxBoardSide {
+		return GameState{}, fmt.Errorf("board size %q should be from 1x1 to %dx%d", fields[1], maxBoardSide, maxBoardSide)
+	}
+	inBoard := func(pos Position) bool {
+		return pos.X >= 0 && pos.X < game.BoardWidth && pos.Y >= 0 && pos.Y < game.BoardHeight
+	}
+
+	snake := fields[2]
+	head, length, err := parsePositionSquare(snake)
+	if err != nil {
+		return GameState{}, fmt.Errorf("snake %q: %v", fields[2], err)
+	}
+	if !inBoard(head) {
+		return GameState{}, fmt.Errorf("snake %q: the head is off the %dx%d board", fields[2], game.BoardWidth, game.BoardHeight)
+	}
+	game.SnakeShape = []Position{head}
+	for snake = snake[length:]; snake != ""; {
+		match := positionStepPattern.FindStringSubmatch(snake)
+		if match == nil {
+			return GameState{}, fmt.Errorf("snake %q: expected a step u, d, l or r at %q", fields[2], snake)
+		}
+		count := 1
+		if match[2] != "" {
+			if count, err = strconv.Atoi(match[2]); err != nil || count < 1 {
+				return GameState{}, fmt.Errorf("snake %q: bad step count %q", fields[2], match[2])
+			}
+		}
+		// The snake has to fit on the board, so a step can't be repeated
+		// more times than there are squares
+		if len(game.SnakeShape)+count > game.BoardWidth*game.BoardHeight {
+			return GameState{}, fmt.Errorf("snake %q is longer than the %dx%d board has squares", fields[2], game.BoardWidth, game.BoardHeight)
+		}
+		for ; count > 0; count-- {
+			next := stepTowards(game.SnakeShape[len(game.SnakeShape)-1], positionSteps[match[1][0]])
+			if !inBoard(next) {
+				return GameState{}, fmt.Errorf("snake %q goes off the board at %q", fields[2], match[0])
+			}
+			game.SnakeShape = append(game.SnakeShape, next)
+		}
+		snake = snake[len(match[0]):]
+	}
+
+	food, length, err := parsePositionSquare(fields[3])
+	if err != nil || length != len(fields[3]) {
+		return GameState{}, fmt.Errorf("food %q should be a square such as H1", fields[3])
+	}
+	game.Food = food
+
+	found := false
+	for direction, letter := range positionDirections {
+		if letter == fields[4] {
+			game.Direction, found = direction, true
+		}
+	}
+	if !found {
+		return GameState{}, fmt.Errorf("direction %q should be u, d, l, r or -", fields[4])
+	}
+
+	if err := game.Validate(); err != nil {
+		return GameState{}, err
+	}
+	return game, nil
+}
+
+// Read the square at the start of some text, returning how much of the text
+// it took up
+func parsePositionSquare(text string) (Position, int, error) {
+	match := positionSquarePattern.FindStringSubmatch(text)
+	if match == nil {
+		return Position{}, 0, errors.New("expected a square such as H3")
+	}
+	x := 0
+	for _, letter := range match[1] {
+		x = x*26 + int(letter-'A'+1)
+		if x > maxBoardSide {
+			return Position{}, 0, fmt.Errorf("column %s is off any board", match[1])
+		}
+	}
+	y, err := strconv.Atoi(match[2])
+	if err != nil || y > maxBoardSide {
+		return Position{}, 0, fmt.Errorf("row %s is off any board", match[2])
+	}
+	return Position{X: x - 1, Y: y - 1}, len(match[0]), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestEncodePosition(t *testing.T) {
+	// setup
+	wideGame := GameState{
+		BoardWidth:  30,
+		BoardHeight: 12,
+		SnakeShape: []Position{
+			{X: 27, Y: 10}, // Head
+			{X: 27, Y: 9},
+			{X: 27, Y: 8},
+			{X: 26, Y: 8},
+		},
+		Food: Position{X: 0, Y: 0},
+	}
+	tests := []struct {
+		game GameState
+		want string
+	}{
+		{boardTextGame, "v1/8x5/H3l2d/H1/r"},
+		{safeGame, "v1/8x5/D3l2/G3/r"},
+		{wideGame, "v1/30x12/AB11u2l/A1/-"},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got, err := encodePosition(test.game)
+
+		// check result
+		if err != nil {
+			t.Errorf("encodePosition(%v) returned error %v", test.game, err)
+		} else if got != test.want {
+			t.Errorf("encodePosition(%v) returned %q, want %q", test.game, got, test.want)
+		}
+	}
+}
+
+func TestPositionsRoundTrip(t *testing.T) {
+	// setup: positions from games the AI plays on boards of a few sizes
+	rng := rand.New(rand.NewSource(11))
+	games := []GameState{}
+	for _, size := range []Position{{X: 8, Y: 5}, {X: 3, Y: 3}, {X: 40, Y: 2}} {
+		game := newGameState(size.X, size.Y, rng)
+		for turn := 0; turn < 60; turn++ {
+			next, _, died := simulateStep(game, rankMoves(game)[0].Move, rng)
+			if died {
+				break
+			}
+			game = next
+			games = append(games, game)
+		}
+	}
+
+	for _, game := range games {
+		position, err := encodePosition(game)
+		if err != nil {
+			t.Fatalf("encodePosition(%v) returned error %v", game, err)
+		}
+
+		// call function to test
+		result, err := decodePosition(position)
+
+		// check result
+		if err != nil {
+			t.Errorf("decodePosition(%q) returned error %v", position, err)
+		} else if !equalGameStates(result, game) {
+			t.Errorf("decodePosition(%q) returned %v, want %v", position, result, game)
+		}
+	}
+}
+
+func TestDecodePositionRejectsBadPositions(t *testing.T) {
+	// setup
+	positions := []string{
+		"",
+		"8x5/H3l2d/H1/r",
+		"v2/8x5/H3l2d/H1/r",
+		"v1/8x5/H3l2d/H1",
+		"v1/8by5/H3l2d/H1/r",
+		"v1/8x5/h3l2d/H1/r",
+		"v1/8x5/H3l2x/H1/r",
+		"v1/8x5/H3l0/H1/r",
+		"v1/8x5/H3r/H1/r",
+		"v1/8x5/H3l2d/H1/x",
+		"v1/8x5/H3l2d/H3/r",
+		"v1/8x5/H3u2r/A1/r",
+		"v1/8x5/H3ldru/A1/r",
+		"v1/8x5/H3l2d/H1x/r",
+		"v1/8x5/H3l300000000/H1/r",
+		"v1/8x5/H3l99999999999999999999/H1/r",
+		"v1/8x5/H3l2u3r2d3l2/H1/r",
+		"v1/100000x100000/A1/B1/-",
+		"v1/8x5/ZZZZZZZZZZZZZZ1/A1/-",
+		"v1/8x5/H99999999999999999999/A1/-",
+	}
+
+	for _, position := range positions {
+		// call function to test
+		_, err := decodePosition(position)
+
+		// check result
+		if err == nil {
+			t.Errorf("decodePosition(%q) returned no error", position)
+		}
+	}
+}
+
+func TestSquareNamesPastZ(t *testing.T) {
+	// setup: a wide board, with the food past column Z
+	game := GameState{BoardWidth: 30, BoardHeight: 5, SnakeShape: []Position{{X: 1, Y: 2}, {X: 0, Y: 2}}, Food: Position{X: 26, Y: 2}, Direction: "right"}
+
+	// call function to test
+	position, err := encodePosition(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prose, err := ProseRenderer{}.RenderBoard(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check result: the notation and the prose name squares the same way
+	if !strings.Contains(position, "/AA3/") || !strings.Contains(prose, "food at AA3") {
+		t.Errorf("position %q and prose %q don't both name the food AA3", position, prose)
+	}
+}
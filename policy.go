@@ -0,0 +1,555 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Everything a voting policy can look at when it decides whether to vote
+type VoteContext struct {
+	Now      time.Time
+	Poll     *mastodon.Poll
+	Options  map[string]int
+	Game     GameState
+	Moves    []MoveEvaluation
+	BestMove string
+	MustTurn bool
+}
+
+// The direction the snake goes if the poll ends now: the option with the
+// most votes, or straight on if nobody has voted. Ties go to the first
+// option, as snakebot counts them.
+func (vc VoteContext) leadingMove() (string, int64) {
+	if vc.Poll == nil || vc.Poll.VotesCount == 0 {
+		return vc.Game.Direction, 0
+	}
+
+	leader := ""
+	var leaderVotes int64 = -1
+	for idx, option := range vc.Poll.Options {
+		for direction, optionIdx := range vc.Options {
+			if optionIdx == idx && option.VotesCount > leaderVotes {
+				leader = direction
+				leaderVotes = option.VotesCount
+			}
+		}
+	}
+
+	if leader == "" {
+		return vc.Game.Direction, 0
+	}
+	return leader, leaderVotes
+}
+
+// The best move that is on offer in the poll, other than the one given,
+// which isn't deadly
+func (vc VoteContext) safestAlternative(exclude string) (MoveEvaluation, bool) {
+	var safest MoveEvaluation
+	found := false
+	for _, evaluation := range vc.Moves {
+		if _, offered := vc.Options[evaluation.Move]; !offered {
+			continue
+		}
+		if evaluation.Move == exclude || evaluation.Deadly {
+			continue
+		}
+		if !found || evaluation.Score > safest.Score {
+			safest = evaluation
+			found = true
+		}
+	}
+	return safest, found
+}
+
+func (vc VoteContext) evaluation(move string) (MoveEvaluation, bool) {
+	for _, evaluation := range vc.Moves {
+		if evaluation.Move == move {
+			return evaluation, true
+		}
+	}
+	return MoveEvaluation{}, false
+}
+
+// A condition which a policy checks before voting
+type VoteCondition interface {
+	check(vc VoteContext) ConditionResult
+	String() string
+}
+
+// Whether a condition holds, which rule settled it, and why, in a form that
+// can go into a post. A condition can also pick the move to vote for
+// instead of the AI's favourite.
+type ConditionResult struct {
+	Holds  bool
+	Rule   string
+	Reason string
+	Move   string
+}
+
+// Decides whether the bot votes on a poll
+type VotePolicy struct {
+	Condition VoteCondition
+}
+
+// The outcome of a policy, with the rule that decided it
+type VoteDecision struct {
+	Vote   bool
+	Move   string
+	Rule   string
+	Reason string
+}
+
+func (p VotePolicy) decide(vc VoteContext) VoteDecision {
+	result := p.Condition.check(vc)
+	decision := VoteDecision{Rule: result.Rule, Reason: result.Reason}
+	if !result.Holds {
+		return decision
+	}
+
+	move := result.Move
+	if move == "" {
+		move = vc.BestMove
+	}
+	if move == "" {
+		decision.Reason = "the AI has no move to suggest"
+		return decision
+	}
+	if _, offered := vc.Options[move]; !offered {
+		decision.Reason = "the poll doesn't offer moving " + move
+		return decision
+	}
+
+	decision.Vote = true
+	decision.Move = move
+	return decision
+}
+
+func (p VotePolicy) String() string {
+	return p.Condition.String()
+}
+
+// Policies which can be chosen by name instead of spelling out the rule
+var namedPolicies = map[string]string{
+	"default":     "any(all(no-votes, default-deadly), counter-vote)",
+	"last-resort": "all(no-votes, default-deadly)",
+	"never":       "never",
+}
+
+func policyNames() string {
+	names := []string{}
+	for name := range namedPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Vote when nobody else has and the snake will die if it keeps going, and
+// vote against the crowd when it is steering the snake into trouble
+const defaultPolicyName = "default"
+
+// Parse a policy from its name or a rule such as
+// "any(all(no-votes, default-deadly), all(quiet-hours(23-7), margin(10)))".
+func parseVotePolicy(spec string) (VotePolicy, error) {
+	if named, ok := namedPolicies[strings.TrimSpace(spec)]; ok {
+		spec = named
+	}
+
+	tokens := tokenizePolicy(spec)
+	node, rest, err := parsePolicyNode(tokens)
+	if err != nil {
+		return VotePolicy{}, fmt.Errorf("invalid policy %q: %v", spec, err)
+	}
+	if len(rest) > 0 {
+		return VotePolicy{}, fmt.Errorf("invalid policy %q: unexpected %q", spec, rest[0])
+	}
+
+	condition, err := buildCondition(node)
+	if err != nil {
+		return VotePolicy{}, fmt.Errorf("invalid policy %q: %v", spec, err)
+	}
+	return VotePolicy{Condition: condition}, nil
+}
+
+func tokenizePolicy(spec string) []string {
+	tokens := []string{}
+	current := strings.Builder{}
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range spec {
+		switch {
+		case r == '(' || r == ')' || r == ',':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// A parsed policy rule: a name, optionally followed by arguments in brackets
+type policyNode struct {
+	name string
+	args []policyNode
+}
+
+func parsePolicyNode(tokens []string) (policyNode, []string, error) {
+	if len(tokens) == 0 {
+		return policyNode{}, nil, fmt.Errorf("unexpected end of rule")
+	}
+	if tokens[0] == "(" || tokens[0] == ")" || tokens[0] == "," {
+		return policyNode{}, nil, fmt.Errorf("unexpected %q", tokens[0])
+	}
+
+	node := policyNode{name: tokens[0]}
+	tokens = tokens[1:]
+	if len(tokens) == 0 || tokens[0] != "(" {
+		return node, tokens, nil
+	}
+
+	tokens = tokens[1:]
+	for {
+		arg, rest, err := parsePolicyNode(tokens)
+		if err != nil {
+			return policyNode{}, nil, err
+		}
+		node.args = append(node.args, arg)
+		tokens = rest
+
+		if len(tokens) == 0 {
+			return policyNode{}, nil, fmt.Errorf("missing ) after arguments of %s", node.name)
+		}
+		if tokens[0] == ")" {
+			return node, tokens[1:], nil
+		}
+		if tokens[0] != "," {
+			return policyNode{}, nil, fmt.Errorf("unexpected %q in arguments of %s", tokens[0], node.name)
+		}
+		tokens = tokens[1:]
+	}
+}
+
+func buildCondition(node policyNode) (VoteCondition, error) {
+	expectArgs := func(count int) error {
+		if len(node.args) != count {
+			return fmt.Errorf("%s takes %d arguments, got %d", node.name, count, len(node.args))
+		}
+		return nil
+	}
+
+	switch node.name {
+	case "all", "any":
+		if len(node.args) == 0 {
+			return nil, fmt.Errorf("%s needs at least one condition", node.name)
+		}
+		conditions := []VoteCondition{}
+		for _, arg := range node.args {
+			condition, err := buildCondition(arg)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+		if node.name == "all" {
+			return allCondition{conditions}, nil
+		}
+		return anyCondition{conditions}, nil
+	case "not":
+		if err := expectArgs(1); err != nil {
+			return nil, err
+		}
+		condition, err := buildCondition(node.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{condition}, nil
+	case "never":
+		return neverCondition{}, expectArgs(0)
+	case "always":
+		return alwaysCondition{}, expectArgs(0)
+	case "no-votes":
+		return noVotesCondition{}, expectArgs(0)
+	case "default-deadly":
+		return defaultDeadlyCondition{}, expectArgs(0)
+	case "leader-deadly":
+		return leaderDeadlyCondition{}, expectArgs(0)
+	case "counter-vote":
+		return counterVoteCondition{}, expectArgs(0)
+	case "quiet-hours":
+		if err := expectArgs(1); err != nil {
+			return nil, err
+		}
+		return parseQuietHours(node.args[0].name)
+	case "margin":
+		if err := expectArgs(1); err != nil {
+			return nil, err
+		}
+		margin, err := strconv.Atoi(node.args[0].name)
+		if err != nil {
+			return nil, fmt.Errorf("margin needs a number, got %q", node.args[0].name)
+		}
+		return marginCondition{margin}, nil
+	}
+
+	return nil, fmt.Errorf("unknown condition %q", node.name)
+}
+
+func conditionResult(c VoteCondition, holds bool, reason string) ConditionResult {
+	return ConditionResult{Holds: holds, Rule: c.String(), Reason: reason}
+}
+
+// Holds when all of its conditions hold
+type allCondition struct {
+	conditions []VoteCondition
+}
+
+func (c allCondition) check(vc VoteContext) ConditionResult {
+	reasons := []string{}
+	move := ""
+	for _, condition := range c.conditions {
+		result := condition.check(vc)
+		if !result.Holds {
+			return result
+		}
+		reasons = append(reasons, result.Reason)
+		if result.Move != "" {
+			move = result.Move
+		}
+	}
+	return ConditionResult{Holds: true, Rule: c.String(), Reason: strings.Join(reasons, " and "), Move: move}
+}
+
+func (c allCondition) String() string {
+	return "all(" + joinConditions(c.conditions) + ")"
+}
+
+// Holds when any of its conditions hold
+type anyCondition struct {
+	conditions []VoteCondition
+}
+
+func (c anyCondition) check(vc VoteContext) ConditionResult {
+	reasons := []string{}
+	for _, condition := range c.conditions {
+		result := condition.check(vc)
+		if result.Holds {
+			return result
+		}
+		reasons = append(reasons, result.Reason)
+	}
+	return ConditionResult{Holds: false, Rule: c.String(), Reason: strings.Join(reasons, " and ")}
+}
+
+func (c anyCondition) String() string {
+	return "any(" + joinConditions(c.conditions) + ")"
+}
+
+func joinConditions(conditions []VoteCondition) string {
+	names := []string{}
+	for _, condition := range conditions {
+		names = append(names, condition.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+type notCondition struct {
+	condition VoteCondition
+}
+
+func (c notCondition) check(vc VoteContext) ConditionResult {
+	result := c.condition.check(vc)
+	return ConditionResult{Holds: !result.Holds, Rule: c.String(), Reason: result.Reason}
+}
+
+func (c notCondition) String() string {
+	return "not(" + c.condition.String() + ")"
+}
+
+type neverCondition struct{}
+
+func (c neverCondition) check(vc VoteContext) ConditionResult {
+	return conditionResult(c, false, "I never vote")
+}
+
+func (neverCondition) String() string { return "never" }
+
+type alwaysCondition struct{}
+
+func (c alwaysCondition) check(vc VoteContext) ConditionResult {
+	return conditionResult(c, true, "I always vote")
+}
+
+func (alwaysCondition) String() string { return "always" }
+
+// Holds when nobody has voted yet
+type noVotesCondition struct{}
+
+func (c noVotesCondition) check(vc VoteContext) ConditionResult {
+	if vc.Poll != nil && vc.Poll.VotesCount > 0 {
+		return conditionResult(c, false, "people have voted")
+	}
+	return conditionResult(c, true, "nobody has voted")
+}
+
+func (noVotesCondition) String() string { return "no-votes" }
+
+// Holds when the snake dies if it keeps going the way it's heading
+type defaultDeadlyCondition struct{}
+
+func (c defaultDeadlyCondition) check(vc VoteContext) ConditionResult {
+	if !vc.MustTurn {
+		return conditionResult(c, false, "the snake is safe if it keeps going "+vc.Game.Direction)
+	}
+	return conditionResult(c, true, "I am worried that the snake is doomed if nothing is done")
+}
+
+func (defaultDeadlyCondition) String() string { return "default-deadly" }
+
+// Holds when the move that is winning the poll is deadly
+type leaderDeadlyCondition struct{}
+
+func (c leaderDeadlyCondition) check(vc VoteContext) ConditionResult {
+	leader, _ := vc.leadingMove()
+	evaluation, ok := vc.evaluation(leader)
+	if !ok || !evaluation.Deadly {
+		return conditionResult(c, false, "the winning move "+leader+" is safe")
+	}
+	return conditionResult(c, true, "the winning move "+leader+" looks deadly")
+}
+
+func (leaderDeadlyCondition) String() string { return "leader-deadly" }
+
+// Holds when people have voted for a deadly move and a safe option is on
+// offer. It votes for the safest alternative rather than the AI's favourite.
+type counterVoteCondition struct{}
+
+func (c counterVoteCondition) check(vc VoteContext) ConditionResult {
+	leader, votes := vc.leadingMove()
+	if votes == 0 {
+		return conditionResult(c, false, "nobody has voted")
+	}
+
+	evaluation, ok := vc.evaluation(leader)
+	if !ok || !evaluation.Deadly {
+		return conditionResult(c, false, "the winning move "+leader+" is safe")
+	}
+
+	alternative, ok := vc.safestAlternative(leader)
+	if !ok {
+		return conditionResult(c, false, "every other option is deadly too")
+	}
+
+	reason := "the poll is leaning towards moving " + leader + ", but then the snake would " + evaluation.Danger
+	if evaluation.Danger == "" {
+		reason = "the poll is leaning towards moving " + leader + ", but that looks deadly"
+	}
+	result := conditionResult(c, true, reason)
+	result.Move = alternative.Move
+	return result
+}
+
+func (counterVoteCondition) String() string { return "counter-vote" }
+
+// Holds during the night, or whenever hardly anyone is watching. The hours
+// are in the bot's local time and may wrap around midnight.
+type quietHoursCondition struct {
+	start, end time.Duration
+	spec       string
+}
+
+func parseQuietHours(spec string) (VoteCondition, error) {
+	startText, endText, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, fmt.Errorf("quiet-hours needs a range like 23-7, got %q", spec)
+	}
+	start, err := parseTimeOfDay(startText)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeOfDay(endText)
+	if err != nil {
+		return nil, err
+	}
+	return quietHoursCondition{start: start, end: end, spec: spec}, nil
+}
+
+// Parse a time of day like 7, 23 or 6:30 as the time since midnight. 24 and
+// 24:00 are midnight at the end of the day.
+func parseTimeOfDay(text string) (time.Duration, error) {
+	hoursText, minutesText, hasMinutes := strings.Cut(text, ":")
+	hours, err := strconv.Atoi(hoursText)
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, fmt.Errorf("invalid hour %q", text)
+	}
+	minutes := 0
+	if hasMinutes {
+		minutes, err = strconv.Atoi(minutesText)
+		if err != nil || minutes < 0 || minutes > 59 {
+			return 0, fmt.Errorf("invalid minutes %q", text)
+		}
+	}
+	if hours == 24 && minutes != 0 {
+		return 0, fmt.Errorf("invalid time %q, the day ends at 24:00", text)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+func (c quietHoursCondition) check(vc VoteContext) ConditionResult {
+	now := vc.Now.Local()
+	sinceMidnight := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+
+	inside := false
+	if c.start <= c.end {
+		inside = sinceMidnight >= c.start && sinceMidnight < c.end
+	} else {
+		inside = sinceMidnight >= c.start || sinceMidnight < c.end
+	}
+
+	if !inside {
+		return conditionResult(c, false, "it isn't quiet hours")
+	}
+	return conditionResult(c, true, "it's the middle of the night")
+}
+
+func (c quietHoursCondition) String() string {
+	return "quiet-hours(" + c.spec + ")"
+}
+
+// Holds when the AI's favourite move beats the move that is winning the
+// poll by at least this much
+type marginCondition struct {
+	margin int
+}
+
+func (c marginCondition) check(vc VoteContext) ConditionResult {
+	leader, _ := vc.leadingMove()
+	best, okBest := vc.evaluation(vc.BestMove)
+	leading, okLeading := vc.evaluation(leader)
+	if !okBest || !okLeading {
+		return conditionResult(c, false, "I can't compare the moves")
+	}
+
+	difference := best.Score - leading.Score
+	if difference < c.margin {
+		return conditionResult(c, false, fmt.Sprintf("moving %s is only %d points better than %s", vc.BestMove, difference, leader))
+	}
+	return conditionResult(c, true, fmt.Sprintf("moving %s is %d points better than %s", vc.BestMove, difference, leader))
+}
+
+func (c marginCondition) String() string {
+	return fmt.Sprintf("margin(%d)", c.margin)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// A poll with the usual four options and the given votes
+func testPoll(votes ...int64) (*mastodon.Poll, map[string]int) {
+	poll := &mastodon.Poll{}
+	options := map[string]int{}
+	for idx, direction := range []string{"up", "down", "left", "right"} {
+		poll.Options = append(poll.Options, mastodon.PollOption{Title: "Move " + direction, VotesCount: votes[idx]})
+		poll.VotesCount += votes[idx]
+		options[direction] = idx
+	}
+	return poll, options
+}
+
+// The vote context for a snake heading right into the wall, where up is the
+// best move and right is deadly
+func doomedVoteContext(votes ...int64) VoteContext {
+	poll, options := testPoll(votes...)
+	return VoteContext{
+		Now:     time.Date(2023, 5, 1, 12, 0, 0, 0, time.Local),
+		Poll:    poll,
+		Options: options,
+		Game:    GameState{Direction: "right"},
+		Moves: []MoveEvaluation{
+			{Move: "up", Score: 38},
+			{Move: "down", Score: 34},
+			{Move: "left", Score: -45, Deadly: true, Danger: "bite itself"},
+			{Move: "right", Score: -45, Deadly: true, Danger: "crash into the wall"},
+		},
+		BestMove: "up",
+		MustTurn: true,
+	}
+}
+
+func TestParseVotePolicy(t *testing.T) {
+	valid := map[string]string{
+		"default":                  "any(all(no-votes, default-deadly), counter-vote)",
+		"last-resort":              "all(no-votes, default-deadly)",
+		"never":                    "never",
+		"any(leader-deadly,never)": "any(leader-deadly, never)",
+		"all( quiet-hours(23-7), not(no-votes), margin(10) )": "all(quiet-hours(23-7), not(no-votes), margin(10))",
+	}
+	for spec, expected := range valid {
+		policy, err := parseVotePolicy(spec)
+		if err != nil {
+			t.Errorf("parseVotePolicy(%q) returned error %v", spec, err)
+			continue
+		}
+		if policy.String() != expected {
+			t.Errorf("parseVotePolicy(%q) returned %s, want %s", spec, policy, expected)
+		}
+	}
+
+	invalid := []string{"", "sometimes", "all()", "all(no-votes", "not(no-votes, never)", "margin(lots)", "quiet-hours(23)", "quiet-hours(24:30-7)", "quiet-hours(23-25)", "never extra"}
+	for _, spec := range invalid {
+		if _, err := parseVotePolicy(spec); err == nil {
+			t.Errorf("parseVotePolicy(%q) returned no error", spec)
+		}
+	}
+}
+
+func TestVotePolicyDecisions(t *testing.T) {
+	tests := []struct {
+		spec     string
+		context  VoteContext
+		vote     bool
+		rule     string
+		expected string
+	}{
+		{"last-resort", doomedVoteContext(0, 0, 0, 0), true, "all(no-votes, default-deadly)", "up"},
+		{"last-resort", doomedVoteContext(0, 1, 0, 0), false, "no-votes", ""},
+		{"default", doomedVoteContext(0, 0, 0, 0), true, "all(no-votes, default-deadly)", "up"},
+		{"default", doomedVoteContext(0, 1, 0, 0), false, "any(all(no-votes, default-deadly), counter-vote)", ""},
+		{"default", doomedVoteContext(0, 0, 0, 2), true, "counter-vote", "up"},
+		{"counter-vote", doomedVoteContext(0, 1, 2, 0), true, "counter-vote", "up"},
+		{"never", doomedVoteContext(0, 0, 0, 0), false, "never", ""},
+		{"leader-deadly", doomedVoteContext(0, 0, 0, 2), true, "leader-deadly", "up"},
+		{"leader-deadly", doomedVoteContext(0, 2, 0, 2), false, "leader-deadly", ""},
+		{"any(never, margin(10))", doomedVoteContext(0, 1, 0, 0), false, "any(never, margin(10))", ""},
+		{"any(never, margin(3))", doomedVoteContext(0, 1, 0, 0), true, "margin(3)", "up"},
+		{"quiet-hours(11-13)", doomedVoteContext(0, 0, 0, 0), true, "quiet-hours(11-13)", "up"},
+		{"quiet-hours(23-7)", doomedVoteContext(0, 0, 0, 0), false, "quiet-hours(23-7)", ""},
+	}
+
+	for _, test := range tests {
+		policy, err := parseVotePolicy(test.spec)
+		if err != nil {
+			t.Fatalf("parseVotePolicy(%q) returned error %v", test.spec, err)
+		}
+
+		decision := policy.decide(test.context)
+		if decision.Vote && decision.Reason == "" {
+			t.Errorf("policy %s decided to vote without a reason", test.spec)
+		}
+		if decision.Vote != test.vote || decision.Rule != test.rule || decision.Move != test.expected {
+			t.Errorf("policy %s decided %+v, want vote=%v rule=%s move=%q", test.spec, decision, test.vote, test.rule, test.expected)
+		}
+	}
+}
+
+func TestVotePolicyOnlyVotesForOfferedMoves(t *testing.T) {
+	context := doomedVoteContext(0, 0, 0, 0)
+	delete(context.Options, "up")
+
+	decision := namedPolicy(t, "last-resort").decide(context)
+	if decision.Vote {
+		t.Errorf("policy decided %+v, want no vote for a move the poll doesn't offer", decision)
+	}
+}
+
+func TestCounterVoteNeedsSafeAlternative(t *testing.T) {
+	context := doomedVoteContext(0, 0, 0, 2)
+
+	// Only the deadly moves are on offer
+	delete(context.Options, "up")
+	delete(context.Options, "down")
+
+	result := counterVoteCondition{}.check(context)
+	if result.Holds {
+		t.Errorf("counter-vote held with no safe alternative: %+v", result)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Words which name a direction outright
+var directionWords = map[string]string{
+	"up":    "up",
+	"down":  "down",
+	"left":  "left",
+	"right": "right",
+	"north": "up",
+	"south": "down",
+	"west":  "left",
+	"east":  "right",
+}
+
+// Arrows and emoji which point in a direction. Emoji variation selectors are
+// skipped when reading an option, so "⬆️" is found as "⬆".
+var directionSymbols = map[rune]string{
+	'↑': "up",
+	'↓': "down",
+	'←': "left",
+	'→': "right",
+	'⬆': "up",
+	'⬇': "down",
+	'⬅': "left",
+	'➡': "right",
+	'👆': "up",
+	'👇': "down",
+	'👈': "left",
+	'👉': "right",
+}
+
+// Words which mean carrying on in the current direction
+var straightWords = map[string]bool{
+	"straight": true,
+	"ahead":    true,
+	"forward":  true,
+	"forwards": true,
+	"onward":   true,
+	"onwards":  true,
+	"continue": true,
+}
+
+// Where the snake ends up after turning left or right from each direction
+var leftTurns = map[string]string{"up": "left", "left": "down", "down": "right", "right": "up"}
+var rightTurns = map[string]string{"up": "right", "right": "down", "down": "left", "left": "up"}
+
+// Split an option title into lower case words, with each arrow as a word of
+// its own
+func pollOptionWords(title string) []string {
+	words := []string{}
+	word := []rune{}
+	endWord := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range title {
+		switch {
+		case unicode.IsLetter(r):
+			word = append(word, unicode.ToLower(r))
+		case directionSymbols[r] != "":
+			endWord()
+			words = append(words, string(r))
+		default:
+			endWord()
+		}
+	}
+	endWord()
+	return words
+}
+
+// Replace an account's own option words with the moves they stand for. The
+// whole title can be one of them, or any word in it.
+func expandOptionWords(title string, optionWords map[string]string) []string {
+	if move, ok := optionWords[strings.ToLower(strings.TrimSpace(title))]; ok {
+		return pollOptionWords(move)
+	}
+
+	words := []string{}
+	for _, word := range pollOptionWords(title) {
+		if move, ok := optionWords[word]; ok {
+			words = append(words, pollOptionWords(move)...)
+		} else {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// Work out which direction a poll option stands for. Options can name a
+// direction ("Move up", "North"), point with an arrow or emoji ("⬆️"), or
+// be relative to the way the snake is heading ("Keep going", "Turn left",
+// "Right turn").
+// Option words are extra wording used by a particular snake game.
+func parsePollOption(title string, heading string, optionWords map[string]string) (string, error) {
+	words := expandOptionWords(title, optionWords)
+	found := map[string]bool{}
+
+	for idx := 0; idx < len(words); idx++ {
+		word := words[idx]
+		next := ""
+		if idx+1 < len(words) {
+			next = words[idx+1]
+		}
+
+		// "Turn left" and "Left turn" are both relative
+		side := ""
+		if word == "turn" && (next == "left" || next == "right") {
+			side = next
+		} else if (word == "left" || word == "right") && next == "turn" {
+			side = word
+		}
+
+		switch {
+		case side != "":
+			turns := leftTurns
+			if side == "right" {
+				turns = rightTurns
+			}
+			if heading == "" {
+				return "", fmt.Errorf("can't resolve %q without knowing which way the snake is heading", title)
+			}
+			found[turns[heading]] = true
+			idx++
+		case straightWords[word] || (word == "keep" && next == "going"):
+			if heading == "" {
+				return "", fmt.Errorf("can't resolve %q without knowing which way the snake is heading", title)
+			}
+			found[heading] = true
+		case directionWords[word] != "":
+			found[directionWords[word]] = true
+		default:
+			for _, r := range word {
+				if direction, ok := directionSymbols[r]; ok {
+					found[direction] = true
+				}
+			}
+		}
+	}
+
+	directions := []string{}
+	for direction := range found {
+		directions = append(directions, direction)
+	}
+	sort.Strings(directions)
+
+	switch len(directions) {
+	case 0:
+		return "", fmt.Errorf("can't find a direction in poll option %q", title)
+	case 1:
+		return directions[0], nil
+	default:
+		return "", fmt.Errorf("poll option %q points %s", title, strings.Join(directions, " and "))
+	}
+}
+
+// Map each direction offered in a poll to its option index. Options which
+// can't be mapped, or which repeat a direction, are reported as errors and
+// left out.
+func parsePollOptions(options []mastodon.PollOption, heading string, optionWords map[string]string) (map[string]int, []error) {
+	lookup := map[string]int{}
+	errs := []error{}
+	for idx, option := range options {
+		direction, err := parsePollOption(option.Title, heading, optionWords)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if previous, ok := lookup[direction]; ok {
+			errs = append(errs, fmt.Errorf("poll options %q and %q both mean %s", options[previous].Title, option.Title, direction))
+			continue
+		}
+		lookup[direction] = idx
+	}
+	return lookup, errs
+}
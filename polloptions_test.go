@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestParsePollOption(t *testing.T) {
+	tests := []struct {
+		title    string
+		heading  string
+		expected string
+	}{
+		{"Move up", "right", "up"},
+		{"move Down", "right", "down"},
+		{"LEFT", "up", "left"},
+		{"Go east!", "up", "right"},
+		{"⬆️", "right", "up"},
+		{"➡", "up", "right"},
+		{"← Move left", "up", "left"},
+		{"👇", "left", "down"},
+		{"Keep going", "left", "left"},
+		{"Straight on", "down", "down"},
+		{"Turn left", "right", "up"},
+		{"Turn right", "right", "down"},
+		{"turn left", "up", "left"},
+		{"Turn right ↓", "right", "down"},
+		{"Left turn", "right", "up"},
+		{"Right turn", "right", "down"},
+		{"right turn", "up", "right"},
+		{"Make a left turn", "down", "right"},
+	}
+
+	for _, test := range tests {
+		result, err := parsePollOption(test.title, test.heading, nil)
+		if err != nil {
+			t.Errorf("parsePollOption(%q, %q) returned error %v", test.title, test.heading, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("parsePollOption(%q, %q) returned %q, want %q", test.title, test.heading, result, test.expected)
+		}
+	}
+
+	invalid := []struct {
+		title   string
+		heading string
+	}{
+		{"", "up"},
+		{"Pass", "up"},
+		{"Up or down", "up"},
+		{"⬅️➡️", "up"},
+		{"Turn left ➡️", "up"},
+		{"Keep going", ""},
+		{"Left turn", ""},
+		{"Left turn ➡️", "up"},
+	}
+	for _, test := range invalid {
+		if result, err := parsePollOption(test.title, test.heading, nil); err == nil {
+			t.Errorf("parsePollOption(%q, %q) returned %q, want an error", test.title, test.heading, result)
+		}
+	}
+}
+
+func TestParsePollOptions(t *testing.T) {
+	// setup poll options
+	options := []mastodon.PollOption{
+		{Title: "⬆️"},
+		{Title: "Keep going"},
+		{Title: "Do a barrel roll"},
+		{Title: "➡️"},
+		{Title: "Turn left"},
+	}
+
+	// call function to test
+	lookup, errs := parsePollOptions(options, "right", nil)
+
+	// check result
+	expected := map[string]int{"up": 0, "right": 1}
+	if len(lookup) != len(expected) {
+		t.Errorf("parsePollOptions returned %v, want %v", lookup, expected)
+	}
+	for direction, idx := range expected {
+		if lookup[direction] != idx {
+			t.Errorf("parsePollOptions returned %v, want %v", lookup, expected)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("parsePollOptions returned errors %v, want one for each of the last three options", errs)
+	}
+}
+
+func TestParsePollOptionWithOptionWords(t *testing.T) {
+	optionWords := map[string]string{"hoch": "up", "weiter": "straight", "⇦": "left", "links abbiegen": "turn left"}
+
+	tests := map[string]string{
+		"Hoch!":          "up",
+		"Weiter":         "right",
+		"⇦":              "left",
+		"Links abbiegen": "up",
+		"Move down":      "down",
+	}
+	for title, expected := range tests {
+		result, err := parsePollOption(title, "right", optionWords)
+		if err != nil || result != expected {
+			t.Errorf("parsePollOption(%q) returned %q, %v, want %q", title, result, err, expected)
+		}
+	}
+}
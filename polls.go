@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"regexp"
+	"sort"
+	"time"
+	"unicode"
 
 	"github.com/mattn/go-mastodon"
 )
@@ -16,155 +17,372 @@ const (
 	NewState
 	NewPoll
 	TimerCheck
+	StateQuery
 )
 
-// Structure for messages to send to the goroutine which votes on polls
+// Structure for messages to send to the goroutine which votes on polls.
+// UpdateID is always the status ID of the board the message is about.
 type PollMessage struct {
 	MessageType PollMessageType
+	Account     *WatchedAccount
 	UpdateID    mastodon.ID
 	MyVote      string
 	MustTurn    bool
 	PollID      mastodon.ID
+	PollURL     string
 	MyUpdateId  mastodon.ID
 	PollOptions []mastodon.PollOption
+	ExpiresAt   time.Time
+	GameState   GameState
+	Moves       []MoveEvaluation
+
+	// For new states, whether the board was edited after it was posted
+	Edited bool
+
+	// For timer checks, how far through the poll the check is and whether
+	// it's the last one
+	Elapsed    float64
+	FinalCheck bool
+
+	// For timer checks, whether the check is only to see if the snake is in
+	// danger and subscribers should be alerted, rather than to vote, and
+	// the clock of the poll's instance, to say how long the poll has left
+	Alert       bool
+	ServerClock *ServerClock
+
+	// For state queries, where to send a copy of every game being followed
+	StateReply chan []GameRecord
 }
 
-type PollProcessState int64
+// How long a record is kept after its poll closes. Poll expiry times come
+// from the server's clock, so this also covers the difference from ours.
+const gameRecordGrace = 10 * time.Minute
 
-const (
-	UndefPollState PollProcessState = iota
-	WaitingForState
-	WaitingForPoll
-	WaitingForTimer
-)
+// How long a board is remembered if its poll never turns up
+const gameRecordLifetime = 24 * time.Hour
+
+// What the worker knows about one of snakebot's boards and the poll which
+// replies to it. Either can arrive first; the bot can vote once it has both.
+type GameRecord struct {
+	Account    *WatchedAccount
+	UpdateID   mastodon.ID
+	Seen       time.Time
+	Analysed   bool
+	MyUpdateId mastodon.ID
+	GameState  GameState
+	Moves      []MoveEvaluation
+	MustTurn   bool
+
+	// The AI's choice among the offered moves, and its favourite if that
+	// wasn't offered
+	MyVote        string
+	PreferredMove string
+
+	PollID      mastodon.ID
+	PollURL     string
+	PollOptions []mastodon.PollOption
+	ExpiresAt   time.Time
+	Options     map[string]int
+	Voted       bool
+
+	// Whether the last voting check and the alert check have run. The
+	// record is kept until both have, whichever comes first.
+	FinalChecked bool
+	AlertChecked bool
+}
+
+// Work out which moves the poll offers, and which of them the AI likes best.
+// Needs both the board and the poll.
+func (r *GameRecord) resolveOptions() {
+	if !r.Analysed || r.PollID == "" {
+		return
+	}
+
+	var optionWords map[string]string
+	if r.Account != nil {
+		optionWords = r.Account.Rules.OptionWords
+	}
+	lookup, errs := parsePollOptions(r.PollOptions, r.GameState.Direction, optionWords)
+	for _, err := range errs {
+		fmt.Println("💪 Error parsing poll option:", err)
+	}
+	r.Options = lookup
+
+	// The AI only gets to pick from the moves on offer
+	offered := rankOfferedMoves(r.Moves, r.Options)
+	if len(offered) == 0 {
+		fmt.Println("💪 None of the poll options are moves the AI knows about")
+		r.MyVote = ""
+	} else if _, ok := r.Options[r.MyVote]; !ok {
+		fmt.Println("💪 The AI's preferred move", r.MyVote, "isn't in the poll, falling back to", offered[0].Move)
+		r.PreferredMove = r.MyVote
+		r.MyVote = offered[0].Move
+	}
+}
+
+// Where the game is up to, for people
+func (r *GameRecord) stage() string {
+	switch {
+	case r.Voted:
+		return fmt.Sprintf("voted %s on poll %s", r.MyVote, r.PollID)
+	case !r.Analysed:
+		return fmt.Sprintf("waiting for the analysis, poll %s", r.PollID)
+	case r.PollID == "":
+		return fmt.Sprintf("analysed, would move %s, waiting for the poll", r.MyVote)
+	default:
+		return fmt.Sprintf("would move %s, watching poll %s until %s", r.MyVote, r.PollID, r.ExpiresAt.Format(time.Kitchen))
+	}
+}
+
+func (r *GameRecord) expired(now time.Time) bool {
+	if r.PollID != "" {
+		return now.After(r.ExpiresAt.Add(gameRecordGrace))
+	}
+	return now.After(r.Seen.Add(gameRecordLifetime))
+}
+
+// The games the worker is following for one account, keyed by the status ID
+// of the board
+type GameRecords map[mastodon.ID]*GameRecord
+
+// The record for a board, starting a new one if it hasn't been seen before
+func (g GameRecords) get(account *WatchedAccount, updateID mastodon.ID, now time.Time) *GameRecord {
+	record, ok := g[updateID]
+	if !ok {
+		record = &GameRecord{Account: account, UpdateID: updateID, Seen: now}
+		g[updateID] = record
+	}
+	return record
+}
+
+// Forget the games whose polls have closed
+func (g GameRecords) prune(now time.Time) {
+	for updateID, record := range g {
+		if record.expired(now) {
+			fmt.Println("💪 Forgetting update", updateID)
+			delete(g, updateID)
+		}
+	}
+}
 
-// This runs as a worker goroutine which processes poll votes
-func processPolls(pollChannel chan PollMessage, client *mastodon.Client) {
+// This runs as a worker goroutine which processes poll votes. It keeps a
+// record for each board, separately for each account, so boards and polls
+// can arrive in any order and several games can be in progress at once. The
+// policy is asked again at every check-in of a poll, until the bot has voted
+// once. Admins can pause voting and change the policy through the controls.
+// Alert checks are handed to the alert worker, which warns subscribers when
+// the snake is in danger, paused or not. The worker stops when the context
+// is cancelled.
+func processPolls(ctx context.Context, pollChannel chan PollMessage, services BotServices, config BotConfig, controls *BotControls, scheduler *PollScheduler) {
 	fmt.Println("💪 Starting poll vote processing goroutine")
 
-	currentState := UndefPollState
-	var currentUpdateID mastodon.ID
-	myVote := ""
-	mustTurn := false
-	var currentPollID mastodon.ID
-	var myUpdateId mastodon.ID
-	optionLookup := make(map[string]int)
-
-	regexMove, err := regexp.Compile(`[Mm]ove (\w+)`)
-	if err != nil {
-		log.Fatal("💪 Error compiling regexp:", err)
+	games := map[string]GameRecords{}
+
+	// Alerts are sent by their own worker, so that they don't hold up votes
+	alertQueue := make(chan AlertRequest, alertQueueSize)
+	if config.Alerts.Subscribers != nil {
+		go processAlerts(ctx, alertQueue, services, config)
 	}
 
 	for {
-		if currentState == UndefPollState {
-			fmt.Println("💪 Syncing to initial poll state")
-
-			// Reset the state
-			currentUpdateID = ""
-			currentPollID = ""
-			myUpdateId = ""
-			myVote = ""
-			mustTurn = false
-			for k := range optionLookup {
-				delete(optionLookup, k)
-			}
-			currentState = WaitingForState
+		fmt.Println("💪 Waiting for message in processPolls goroutine. Following", len(games), "accounts")
+
+		var message PollMessage
+		select {
+		case message = <-pollChannel:
+		case <-ctx.Done():
+			fmt.Println("💪 Stopping poll vote processing goroutine")
+			return
+		}
+		fmt.Println("💪 Received poll message:", message)
+
+		now := services.Clock.Now()
+		for _, records := range games {
+			records.prune(now)
 		}
 
-		fmt.Println("💪 Waiting for message in processPolls goroutine. Current state is", currentState)
+		if message.MessageType == StateQuery {
+			copies := []GameRecord{}
+			for _, records := range games {
+				for _, record := range records {
+					copies = append(copies, *record)
+				}
+			}
+			sort.Slice(copies, func(i, j int) bool {
+				return copies[i].Seen.Before(copies[j].Seen)
+			})
+			message.StateReply <- copies
+			continue
+		}
 
-		message := <-pollChannel
-		fmt.Println("💪 Received poll message:", message)
+		acct := ""
+		if message.Account != nil {
+			acct = message.Account.Acct
+		}
+		records, ok := games[acct]
+		if !ok {
+			records = GameRecords{}
+			games[acct] = records
+		}
 
 		switch message.MessageType {
 		case NewState:
-			if currentState != WaitingForState {
-				fmt.Println("💪 Received new state message while not waiting for start. Resetting state.")
-				currentState = UndefPollState
+			record := records.get(message.Account, message.UpdateID, now)
+			if record.Analysed && !message.Edited {
+				fmt.Println("💪 Already analysed update", message.UpdateID)
 				continue
 			}
-			currentUpdateID = message.UpdateID
-			myVote = message.MyVote
-			mustTurn = message.MustTurn
-			currentState = WaitingForPoll
-			myUpdateId = message.MyUpdateId
+			record.Analysed = true
+			record.PreferredMove = ""
+			record.MyVote = message.MyVote
+			record.MustTurn = message.MustTurn
+			record.MyUpdateId = message.MyUpdateId
+			record.GameState = message.GameState
+			record.Moves = message.Moves
+			record.resolveOptions()
 		case NewPoll:
-			if currentState != WaitingForPoll {
-				fmt.Println("💪 Received new poll message while not waiting for poll. Resetting state.")
-				currentState = UndefPollState
-				continue
+			record := records.get(message.Account, message.UpdateID, now)
+			if record.PollID != "" && record.PollID != message.PollID {
+				fmt.Println("💪 Update", message.UpdateID, "already has poll", record.PollID, "- replacing it with", message.PollID)
+				record.Voted = false
+				record.FinalChecked = false
+				record.AlertChecked = false
+				// The old poll's checks would only be ignored
+				if message.Account != nil {
+					scheduler.cancel(pollCheckKey(message.Account, record.PollID))
+					scheduler.cancel(alertCheckKey(message.Account, record.PollID))
+				}
 			}
-			if message.UpdateID != currentUpdateID {
-				fmt.Println("💪 Received new poll message with different update ID. Resetting state.")
-				currentState = UndefPollState
+			record.PollID = message.PollID
+			record.PollURL = message.PollURL
+			record.PollOptions = message.PollOptions
+			record.ExpiresAt = message.ExpiresAt
+			record.resolveOptions()
+		case TimerCheck:
+			record, ok := records[message.UpdateID]
+			if !ok || record.PollID != message.PollID {
+				fmt.Println("💪 Ignoring timer check for poll", message.PollID, "which isn't being followed")
 				continue
 			}
-			currentPollID = message.PollID
-			for i, option := range message.PollOptions {
-				matchMove := regexMove.FindStringSubmatch(option.Title)
-				if len(matchMove) != 2 {
-					fmt.Println("💪 Error parsing move from poll option title:", option.Title)
-					continue
+			if message.Alert {
+				record.AlertChecked = true
+				if record.Analysed {
+					queueAlert(alertQueue, AlertRequest{Record: *record, ServerClock: message.ServerClock})
+				}
+				if record.FinalChecked {
+					delete(records, message.UpdateID)
 				}
-				direction := matchMove[1]
-				optionLookup[direction] = i
-			}
-			currentState = WaitingForTimer
-		case TimerCheck:
-			if currentState != WaitingForTimer {
-				fmt.Println("💪 Received timer check message while not waiting for timer. Resetting state.")
-				currentState = UndefPollState
 				continue
 			}
-			if message.PollID != currentPollID {
-				fmt.Println("💪 Received timer check message with different poll ID. Resetting state.")
-				currentState = UndefPollState
+			if message.FinalCheck {
+				// The poll is about to close, so this is the last vote. The
+				// record stays for the alert check if that's still to come.
+				record.FinalChecked = true
+				if record.AlertChecked || config.Alerts.Subscribers == nil {
+					delete(records, message.UpdateID)
+				}
+			}
+			if !record.Analysed {
+				fmt.Println("💪 No analysis of update", message.UpdateID, "yet, so not checking poll", message.PollID)
 				continue
 			}
 
-			poll, err := client.GetPoll(context.Background(), mastodon.ID(currentPollID))
+			poll, err := services.Polls.GetPoll(context.Background(), record.PollID)
 			if err != nil {
 				fmt.Println("💪 Error getting poll:", err)
-				currentState = UndefPollState
 				continue
 			}
 
-			fmt.Println("💪 Got poll and counted votes:", poll.VotesCount)
+			fmt.Printf("💪 Got poll and counted %d votes %.0f%% of the way through\n", poll.VotesCount, message.Elapsed*100)
 
-			// If there is already at least one vote, don't vote
-			if poll.VotesCount > 0 {
-				fmt.Println("💪 There are already votes. Not voting.")
-				currentState = UndefPollState
+			if config.Archive != nil {
+				if err := config.Archive.writePoll(poll, message.Elapsed); err != nil {
+					fmt.Println("💪 Error archiving poll:", err)
+				}
+			}
+
+			if record.Voted {
+				fmt.Println("💪 Already voted on this poll")
 				continue
 			}
 
-			// Vote for the option that matches myVote
-			if mustTurn && myVote != "" {
-				// Post a message to mastodon saying that we're voting
-				msg := "Nobody has voted and I am worried that the snake is doomed if nothing is done! "
-				msg += "I usually don't vote, but this time, I'm voting to move " + myVote + "."
-				_, err := client.PostStatus(context.Background(), &mastodon.Toot{
-					Status:      msg,
-					InReplyToID: myUpdateId,
-				})
-				if err != nil {
-					fmt.Println("💪 Error posting status:", err)
-				}
+			if controls.isVotingPaused() {
+				fmt.Println("💪 Voting is paused, so not asking the policy")
+				continue
+			}
 
-				fmt.Println("💪 Posted message to mastodon about my vote")
+			// Ask the voting policy whether to step in
+			decision := controls.currentPolicy().decide(VoteContext{
+				Now:      now,
+				Poll:     poll,
+				Options:  record.Options,
+				Game:     record.GameState,
+				Moves:    record.Moves,
+				BestMove: record.MyVote,
+				MustTurn: record.MustTurn,
+			})
+			fmt.Printf("💪 Policy %s decided vote=%v move=%q because %s\n", decision.Rule, decision.Vote, decision.Move, decision.Reason)
 
-				// Vote
-				vote := optionLookup[myVote]
+			if decision.Vote {
+				// Vote. The policy only picks offered moves, so the lookup
+				// always succeeds. A vote which fails is tried again at the
+				// next check-in.
+				vote := record.Options[decision.Move]
 				fmt.Println("💪 Voting for option", vote)
 
-				_, err = client.PollVote(context.Background(), currentPollID, vote)
+				votedPoll, err := services.Voter.Vote(context.Background(), record.PollID, decision.Move, vote)
 				if err != nil {
 					fmt.Println("💪 Error voting:", err)
+					continue
 				}
-			}
+				if votedPoll != nil && !votedPoll.Voted {
+					// A dry run doesn't vote, so there's nothing to announce
+					// and the poll is still open to a real vote
+					fmt.Println("💪 The vote wasn't cast, so not announcing it")
+					continue
+				}
+				record.Voted = true
 
-			// Reset the state
-			currentState = UndefPollState
+				// Post a message to mastodon saying that we've voted
+				fields := PostFields{
+					Move:   decision.Move,
+					Scores: record.Moves,
+					Danger: record.MustTurn,
+					Reason: decision.Reason,
+				}
+				if decision.Move == record.MyVote {
+					fields.PreferredMove = record.PreferredMove
+				}
+				msg, err := config.Composer.composeVote(fields)
+				if err != nil {
+					fmt.Println("💪 Error composing status:", err)
+				} else if _, err := services.Publisher.PostStatus(context.Background(), config.Posting.toot(msg, record.MyUpdateId)); err != nil {
+					fmt.Println("💪 Error posting status:", err)
+				} else {
+					fmt.Println("💪 Posted message to mastodon about my vote")
+				}
+			}
 		}
 	}
 }
+
+// Send a message to the poll worker, unless the bot is stopping. Returns
+// false if the message wasn't sent.
+func sendPollMessage(ctx context.Context, pollChannel chan PollMessage, message PollMessage) bool {
+	select {
+	case pollChannel <- message:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Capitalise the first letter of a phrase so that it can start a sentence
+func sentence(phrase string) string {
+	if phrase == "" {
+		return phrase
+	}
+	runes := []rune(phrase)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
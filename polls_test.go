@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestGameRecordsExpire(t *testing.T) {
+	// setup records
+	start := schedulerStart
+	records := GameRecords{}
+	withPoll := records.get(nil, "1", start)
+	withPoll.PollID = "10"
+	withPoll.ExpiresAt = start.Add(30 * time.Minute)
+	records.get(nil, "2", start)
+
+	// call function to test
+	records.prune(start.Add(30*time.Minute + gameRecordGrace + time.Second))
+
+	// check result
+	if _, ok := records["1"]; ok {
+		t.Errorf("record for a closed poll wasn't pruned")
+	}
+	if _, ok := records["2"]; !ok {
+		t.Errorf("record still waiting for its poll was pruned")
+	}
+
+	records.prune(start.Add(gameRecordLifetime + time.Second))
+	if len(records) != 0 {
+		t.Errorf("records %v left after their lifetime, want none", records)
+	}
+}
+
+func TestPollWorkerStopsWithTheBot(t *testing.T) {
+	// setup
+	ctx, cancel := context.WithCancel(context.Background())
+	pollChannel := make(chan PollMessage)
+	stopped := make(chan struct{})
+	go func() {
+		clock := newFakeClock(schedulerStart)
+		processPolls(ctx, pollChannel, BotServices{Clock: clock}, BotConfig{}, newBotControls(VotePolicy{}), newPollScheduler(clock))
+		close(stopped)
+	}()
+
+	// call function to test
+	cancel()
+
+	// check result: the worker returns, and late timer checks don't block
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("processPolls kept running after the context was cancelled")
+	}
+	if sendPollMessage(ctx, pollChannel, PollMessage{MessageType: TimerCheck}) {
+		t.Errorf("sendPollMessage sent a message to a stopped worker")
+	}
+}
+
+func TestPollWorkerCancelsTheChecksOfReplacedPolls(t *testing.T) {
+	// setup: a poll with its checks scheduled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newFakeClock(schedulerStart)
+	scheduler := newPollScheduler(clock)
+	account := &WatchedAccount{Acct: "snake_game@botsin.space"}
+	pollChannel := make(chan PollMessage)
+	go processPolls(ctx, pollChannel, BotServices{Clock: clock}, BotConfig{}, newBotControls(VotePolicy{}), scheduler)
+
+	expiresAt := schedulerStart.Add(testPollTimeLeft)
+	for _, pollID := range []mastodon.ID{"10", "11"} {
+		scheduler.schedule(pollCheckKey(account, pollID), newServerClock(clock), pollID, schedulerStart, expiresAt, defaultCheckIns, func(ScheduledCheck) {})
+		scheduler.schedule(alertCheckKey(account, pollID), newServerClock(clock), pollID, schedulerStart, expiresAt, []CheckIn{{Lead: defaultAlertLead}}, func(ScheduledCheck) {})
+	}
+
+	// call function to test: snakebot replaces the board's poll
+	sendPollMessage(ctx, pollChannel, PollMessage{MessageType: NewPoll, Account: account, UpdateID: "1", PollID: "10", ExpiresAt: expiresAt})
+	sendPollMessage(ctx, pollChannel, PollMessage{MessageType: NewPoll, Account: account, UpdateID: "1", PollID: "11", ExpiresAt: expiresAt})
+	// The worker has handled the replacement once it answers a query
+	reply := make(chan []GameRecord, 1)
+	sendPollMessage(ctx, pollChannel, PollMessage{MessageType: StateQuery, StateReply: reply})
+	<-reply
+
+	// check result: only the new poll's checks are left
+	checks := scheduler.pendingChecks()
+	if len(checks) != 2 {
+		t.Fatalf("scheduler has %d checks pending, want the new poll's 2", len(checks))
+	}
+	for _, check := range checks {
+		if check.PollID != "11" {
+			t.Errorf("check %+v for the replaced poll is still pending", check)
+		}
+	}
+}
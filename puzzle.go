@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// How many puzzles one account can ask about in each window, by default
+const (
+	defaultPuzzleLimit  = 3
+	defaultPuzzleWindow = time.Hour
+)
+
+// What the asker is told when their puzzle can't be read. The error itself
+// can say things about the bot's insides, so it only goes in the log.
+const puzzleFailureReason = "it doesn't look like a board or position I know"
+
+// How the bot answers people who mention it with a board of their own
+type PuzzleConfig struct {
+	// Whether to answer puzzles at all
+	Enabled bool
+
+	// How many puzzles one account can ask about in each Window. The
+	// defaults are defaultPuzzleLimit and defaultPuzzleWindow.
+	Limit  int
+	Window time.Duration
+}
+
+// Keeps each account to its share of something, such as puzzles
+type AccountLimiter struct {
+	limit  int
+	window time.Duration
+	clock  Clock
+	asked  map[string][]time.Time
+}
+
+func newAccountLimiter(limit int, window time.Duration, clock Clock) *AccountLimiter {
+	return &AccountLimiter{limit: limit, window: window, clock: clock, asked: make(map[string][]time.Time)}
+}
+
+func newPuzzleLimiter(config PuzzleConfig, clock Clock) *AccountLimiter {
+	limit, window := config.Limit, config.Window
+	if limit <= 0 {
+		limit = defaultPuzzleLimit
+	}
+	if window <= 0 {
+		window = defaultPuzzleWindow
+	}
+	return newAccountLimiter(limit, window, clock)
+}
+
+// Count a request from an account. Returns false if the account has
+// already made as many as it can in the window.
+func (l *AccountLimiter) allow(acct string) bool {
+	now := l.clock.Now()
+	recent := []time.Time{}
+	for _, asked := range l.asked[acct] {
+		if now.Sub(asked) < l.window {
+			recent = append(recent, asked)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.asked[acct] = recent
+		return false
+	}
+	l.asked[acct] = append(recent, now)
+	return true
+}
+
+// What someone asked the bot to look at: a board image, or a position
+// written in the notation
+type Puzzle struct {
+	Image    *mastodon.Attachment
+	Position string
+}
+
+var positionInTextPattern = regexp.MustCompile(`\bv\d+/\S+`)
+
+// Find the puzzle in a mention. The first image wins over any position in
+// the text. Returns false if there's neither.
+func findPuzzle(status *mastodon.Status) (Puzzle, bool) {
+	for idx := range status.MediaAttachments {
+		if status.MediaAttachments[idx].Type == "image" {
+			return Puzzle{Image: &status.MediaAttachments[idx]}, true
+		}
+	}
+	if position := positionInTextPattern.FindString(statusText(status.Content)); position != "" {
+		return Puzzle{Position: strings.TrimRight(position, ".,;:!?)")}, true
+	}
+	return Puzzle{}, false
+}
+
+// Run the vision pipeline or read the position, and then the AI. Images
+// are read by the rules of the snake game they're most likely from.
+func (p Puzzle) analyze(rules AccountRules) (Analysis, error) {
+	if p.Image != nil {
+		return analyzeAttachment(*p.Image, rules, os.Stdout)
+	}
+
+	game, err := decodePosition(p.Position)
+	if err != nil {
+		return Analysis{}, err
+	}
+	return analyzeGameState(game, os.Stdout)
+}
+
+var (
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// The text of a status, without its HTML
+func statusText(content string) string {
+	text := htmlBreakPattern.ReplaceAllString(content, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// How private each visibility is
+var visibilityPrivacy = map[string]int{"public": 0, "unlisted": 1, "private": 2, "direct": 3}
+
+// A reply is never more public than the status it replies to
+func replyVisibility(configured, mention string) string {
+	if visibilityPrivacy[mention] > visibilityPrivacy[configured] {
+		return mention
+	}
+	return configured
+}
+
+// How many puzzles can wait for the puzzle worker. Puzzles which come in
+// while the queue is full are dropped.
+const puzzleQueueSize = 10
+
+// A puzzle someone has asked about, waiting to be answered
+type PuzzleRequest struct {
+	Mention *mastodon.Status
+	Puzzle  Puzzle
+}
+
+// Queue a mention with a puzzle in it for the puzzle worker. Mentions without
+// a puzzle, puzzles over the asker's limit, and puzzles which don't fit in
+// the queue are ignored.
+func handleMention(queue chan<- PuzzleRequest, limiter *AccountLimiter, mention *mastodon.Status) {
+	asker := mention.Account.Acct
+	puzzle, ok := findPuzzle(mention)
+	if !ok {
+		fmt.Println("🧩 Mention from", asker, "has no board or position in it, so ignoring it")
+		return
+	}
+	if !limiter.allow(asker) {
+		fmt.Println("🧩", asker, "has asked about", limiter.limit, "puzzles in the last", limiter.window, "so ignoring this one")
+		return
+	}
+
+	select {
+	case queue <- PuzzleRequest{Mention: mention, Puzzle: puzzle}:
+	default:
+		fmt.Println("🧩 Too many puzzles waiting, so ignoring the one from", asker)
+	}
+}
+
+// Answer queued puzzles one at a time, apart from the stream, so that slow
+// images don't hold up the games. Runs until the context is cancelled.
+func processPuzzles(ctx context.Context, queue <-chan PuzzleRequest, services BotServices, config BotConfig, rules AccountRules) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case request := <-queue:
+			answerPuzzle(services, config, rules, request)
+		}
+	}
+}
+
+// Answer a puzzle: the ranked moves, the board and the analysis image, or
+// why the puzzle couldn't be read
+func answerPuzzle(services BotServices, config BotConfig, rules AccountRules, request PuzzleRequest) {
+	mention := request.Mention
+	asker := mention.Account.Acct
+	fmt.Println("🧩 Solving a puzzle from", asker)
+
+	fields := PostFields{Asker: "@" + asker}
+	var mediaIDs []mastodon.ID
+	analysis, err := request.Puzzle.analyze(rules)
+	if err != nil {
+		fmt.Println("🧩 Failed to read the puzzle:", err)
+		fields.Reason = puzzleFailureReason
+	} else {
+		boards := config.Posting.Boards
+		board, err := boards.Post.RenderBoard(analysis.GameState)
+		if err != nil {
+			fmt.Println("🧩 Failed to draw the board:", err)
+		}
+		fields.Board = board
+		fields.Move = analysis.BestMove
+		fields.Scores = analysis.Moves
+		fields.Danger = analysis.MustTurn
+		fields.Position = analysis.Position
+
+		if services.Media != nil {
+			mediaID, err := uploadAnalysisImage(context.Background(), services.Media, analysis, boards.AltText)
+			if err != nil {
+				fmt.Println("🧩 Failed to upload the analysis image, so answering without it:", err)
+			} else {
+				mediaIDs = append(mediaIDs, mediaID)
+			}
+		}
+	}
+
+	status, err := config.Composer.composePuzzle(fields)
+	if err != nil {
+		fmt.Println("🧩 Failed to compose the answer:", err)
+		return
+	}
+	toot := config.Posting.toot(status, mention.ID)
+	toot.Visibility = replyVisibility(config.Posting.Visibility, mention.Visibility)
+	toot.MediaIDs = mediaIDs
+	if _, err := makePost(services.Publisher, toot); err != nil {
+		fmt.Println("🧩 Failed to answer the puzzle:", err)
+		return
+	}
+	fmt.Println("🧩 Answered", asker)
+}
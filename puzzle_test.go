@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestPuzzleLimiter(t *testing.T) {
+	// setup
+	clock := newFakeClock(time.Now())
+	limiter := newPuzzleLimiter(PuzzleConfig{Limit: 2, Window: time.Hour}, clock)
+
+	steps := []struct {
+		advance time.Duration
+		acct    string
+		want    bool
+	}{
+		{0, "alice", true},
+		{10 * time.Minute, "alice", true},
+		{10 * time.Minute, "alice", false},
+		{0, "bob", true},
+		// The first puzzle is an hour old, so there's room for one more
+		{40 * time.Minute, "alice", true},
+		{0, "alice", false},
+	}
+
+	for idx, step := range steps {
+		clock.Advance(step.advance)
+
+		// call function to test
+		got := limiter.allow(step.acct)
+
+		// check result
+		if got != step.want {
+			t.Errorf("step %d: allow(%q) returned %v, want %v", idx, step.acct, got, step.want)
+		}
+	}
+}
+
+func TestFindPuzzle(t *testing.T) {
+	// setup
+	image := mastodon.Attachment{Type: "image", URL: "https://example.com/board.png"}
+	tests := []struct {
+		name     string
+		status   *mastodon.Status
+		want     Puzzle
+		wantFind bool
+	}{
+		{"position", &mastodon.Status{Content: `<p><span class="h-card"><a href="https://example.com/@bot">@<span>bot</span></a></span> what about v1/8x5/H3l2d/H1/r?</p>`}, Puzzle{Position: "v1/8x5/H3l2d/H1/r"}, true},
+		{"image", &mastodon.Status{Content: "<p>v1/8x5/H3l2d/H1/r</p>", MediaAttachments: []mastodon.Attachment{{Type: "video"}, image}}, Puzzle{Image: &image}, true},
+		{"nothing", &mastodon.Status{Content: "<p>I love this snake</p>", MediaAttachments: []mastodon.Attachment{{Type: "video"}}}, Puzzle{}, false},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got, found := findPuzzle(test.status)
+
+		// check result
+		if found != test.wantFind || got.Position != test.want.Position || (got.Image == nil) != (test.want.Image == nil) {
+			t.Errorf("findPuzzle with %s returned %v, %v, want %v, %v", test.name, got, found, test.want, test.wantFind)
+		}
+		if got.Image != nil && got.Image.URL != test.want.Image.URL {
+			t.Errorf("findPuzzle with %s returned image %s, want %s", test.name, got.Image.URL, test.want.Image.URL)
+		}
+	}
+}
+
+func TestPuzzleRejectsHugeSnakes(t *testing.T) {
+	// setup: a position whose snake is far longer than its board
+	puzzle := Puzzle{Position: "v1/8x5/H3l300000000/H1/r"}
+
+	// call function to test
+	_, err := puzzle.analyze(defaultAccountRules())
+
+	// check result
+	if err == nil {
+		t.Errorf("analyze returned no error for a snake longer than the board")
+	}
+}
+
+func TestHandleMentionDropsPuzzlesWhenTheQueueIsFull(t *testing.T) {
+	// setup: a queue with no room left
+	queue := make(chan PuzzleRequest, 1)
+	queue <- PuzzleRequest{}
+	limiter := newPuzzleLimiter(PuzzleConfig{}, newFakeClock(time.Now()))
+	mention := &mastodon.Status{Account: mastodon.Account{Acct: "alice"}, Content: "<p>v1/8x5/H3l2d/H1/r</p>"}
+
+	// call function to test
+	done := make(chan struct{})
+	go func() {
+		handleMention(queue, limiter, mention)
+		close(done)
+	}()
+
+	// check result
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("handleMention blocked on a full queue")
+	}
+	if len(queue) != 1 {
+		t.Errorf("queue has %d puzzles, want 1", len(queue))
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	// setup
+	content := `<p>Is this <a href="https://example.com">right</a>?</p><p>&quot;Up&quot; &amp; then<br />left</p>`
+
+	// call function to test
+	got := statusText(content)
+
+	// check result
+	want := "Is this right?\n\"Up\" & then\nleft"
+	if got != want {
+		t.Errorf("statusText returned %q, want %q", got, want)
+	}
+}
+
+func TestReplyVisibility(t *testing.T) {
+	// setup
+	tests := []struct {
+		configured, mention, want string
+	}{
+		{"", "public", ""},
+		{"unlisted", "public", "unlisted"},
+		{"public", "private", "private"},
+		{"unlisted", "direct", "direct"},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got := replyVisibility(test.configured, test.mention)
+
+		// check result
+		if got != test.want {
+			t.Errorf("replyVisibility(%q, %q) returned %q, want %q", test.configured, test.mention, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"image"
+	imagecolor "image/color"
+)
+
+// Colours used for the empty board spaces. They only need to be distinct
+// from the snake, food and eye colours so that rendered boards can be read
+// back by the image processing code.
+var lightSquareColor = color{0xB8, 0xB8, 0xB8}
+var darkSquareColor = color{0xA0, 0xA0, 0xA0}
+
+// Draw a game state as a PNG-ready image, in the same style as snakebot's
+// board images. The snake is drawn as a band that reaches the edge of the
+// space on the sides where it connects to its neighbours, and the head has
+// eyes on its diagonal.
+func renderGameStateImage(game GameState, cellSize int) (*image.RGBA, error) {
+	snakeSpaceGrid, err := convertGameStateToSnakeSpaceGrid(game)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderSnakeSpaceGridImage(snakeSpaceGrid, cellSize), nil
+}
+
+func renderSnakeSpaceGridImage(snakeSpaceGrid [][]SnakeSpace, cellSize int) *image.RGBA {
+	height := len(snakeSpaceGrid)
+	width := len(snakeSpaceGrid[0])
+	img := image.NewRGBA(image.Rect(0, 0, width*cellSize, height*cellSize))
+
+	for y, row := range snakeSpaceGrid {
+		for x, snakeSpace := range row {
+			cell := image.Rect(x*cellSize, y*cellSize, (x+1)*cellSize, (y+1)*cellSize)
+			drawSnakeSpace(img, cell, snakeSpace, (x+y)%2 == 0)
+		}
+	}
+
+	return img
+}
+
+func drawSnakeSpace(img *image.RGBA, cell image.Rectangle, snakeSpace SnakeSpace, isEven bool) {
+	background := darkSquareColor
+	if isEven {
+		background = lightSquareColor
+	}
+	fillRect(img, cell, background)
+
+	size := cell.Dx()
+	inset := size / 5
+	center := cell.Inset(inset)
+
+	switch snakeSpace.SnakeSlot {
+	case Food:
+		fillRect(img, center, foodColor)
+	case Snake, Head:
+		fillRect(img, center, snakeColor)
+
+		// Extend the band to the edges we connect to
+		if snakeSpace.Adjacencies&Up != 0 {
+			fillRect(img, image.Rect(center.Min.X, cell.Min.Y, center.Max.X, center.Min.Y), snakeColor)
+		}
+		if snakeSpace.Adjacencies&Down != 0 {
+			fillRect(img, image.Rect(center.Min.X, center.Max.Y, center.Max.X, cell.Max.Y), snakeColor)
+		}
+		if snakeSpace.Adjacencies&Left != 0 {
+			fillRect(img, image.Rect(cell.Min.X, center.Min.Y, center.Min.X, center.Max.Y), snakeColor)
+		}
+		if snakeSpace.Adjacencies&Right != 0 {
+			fillRect(img, image.Rect(center.Max.X, center.Min.Y, cell.Max.X, center.Max.Y), snakeColor)
+		}
+
+		if snakeSpace.SnakeSlot == Head {
+			// Eyes sit on the diagonal, which is where sampleEyes looks for them.
+			// They must stay clear of the centre, which is sampled for the slot.
+			eyeSize := size / 10
+			if eyeSize < 1 {
+				eyeSize = 1
+			}
+			for _, offset := range []int{size / 4, size * 5 / 8} {
+				eye := image.Rect(cell.Min.X+offset, cell.Min.Y+offset, cell.Min.X+offset+eyeSize, cell.Min.Y+offset+eyeSize)
+				fillRect(img, eye.Inset(-1), whiteColor)
+				fillRect(img, eye, blackColor)
+			}
+		}
+	}
+}
+
+func fillRect(img *image.RGBA, rect image.Rectangle, c color) {
+	fill := imagecolor.RGBA{R: uint8(c.r), G: uint8(c.g), B: uint8(c.b), A: 0xFF}
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetRGBA(x, y, fill)
+		}
+	}
+}
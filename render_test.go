@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestRenderedImageAnalyzesToSameGameState(t *testing.T) {
+	// setup game state
+	game := GameState{
+		BoardWidth:  8,
+		BoardHeight: 5,
+		SnakeShape: []Position{
+			{X: 3, Y: 2}, // Head
+			{X: 2, Y: 2},
+			{X: 2, Y: 3},
+			{X: 3, Y: 3},
+			{X: 4, Y: 3}, // Tail
+		},
+		Food:      Position{X: 6, Y: 1},
+		Direction: "right",
+	}
+
+	// render the board and read it back
+	img, err := renderGameStateImage(game, 40)
+	if err != nil {
+		t.Fatalf("renderGameStateImage returned error %v", err)
+	}
+	analysis, err := analyzeBoardImage(img, game.BoardWidth, game.BoardHeight, defaultPalette, io.Discard)
+	if err != nil {
+		t.Fatalf("analyzeBoardImage returned error %v", err)
+	}
+
+	// check result
+	if !equalGameStates(analysis.GameState, game) {
+		t.Errorf("analyzeBoardImage returned %v, want %v", analysis.GameState, game)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Tells the time and runs functions later. The bot uses the real clock;
+// tests use a fake one which only moves when they advance it.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// A pending call scheduled on a Clock
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// How many server timestamps to remember when estimating the server clock
+const serverClockSamples = 20
+
+// Estimates the Mastodon server's clock from the timestamps of statuses as
+// they arrive. Each sample is how far our clock is ahead of the server's
+// timestamp when we see a status, which is the clock difference plus the
+// delivery delay. The smallest recent sample has the least delay in it, so
+// that's the one used.
+type ServerClock struct {
+	mutex   sync.Mutex
+	clock   Clock
+	samples []time.Duration
+}
+
+func newServerClock(clock Clock) *ServerClock {
+	return &ServerClock{clock: clock}
+}
+
+// Record a server timestamp of something which has just happened
+func (c *ServerClock) observe(serverTime time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.samples = append(c.samples, c.clock.Now().Sub(serverTime))
+	if len(c.samples) > serverClockSamples {
+		c.samples = c.samples[1:]
+	}
+}
+
+// How far our clock is ahead of the server's
+func (c *ServerClock) offset() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.samples) == 0 {
+		return 0
+	}
+	offset := c.samples[0]
+	for _, sample := range c.samples[1:] {
+		if sample < offset {
+			offset = sample
+		}
+	}
+	return offset
+}
+
+// The current time according to the server
+func (c *ServerClock) now() time.Time {
+	return c.clock.Now().Add(-c.offset())
+}
+
+// The clocks of every instance the watched accounts live on. Each instance
+// has its own clock, which may be off from the others.
+type ServerClocks struct {
+	mutex  sync.Mutex
+	clock  Clock
+	clocks map[string]*ServerClock
+}
+
+func newServerClocks(clock Clock) *ServerClocks {
+	return &ServerClocks{clock: clock, clocks: make(map[string]*ServerClock)}
+}
+
+// The clock of the instance an account is on, by the domain of its acct.
+// Accounts on our own instance have no domain.
+func (c *ServerClocks) forAcct(acct string) *ServerClock {
+	_, domain, _ := strings.Cut(acct, "@")
+	domain = strings.ToLower(domain)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	serverClock, ok := c.clocks[domain]
+	if !ok {
+		serverClock = newServerClock(c.clock)
+		c.clocks[domain] = serverClock
+	}
+	return serverClock
+}
+
+// A poll check waiting for its timer. Elapsed is how far through the poll
+// the check is, and the final check is the last one before the poll expires.
+type ScheduledCheck struct {
+	Key     string
+	PollID  mastodon.ID
+	FireAt  time.Time
+	Elapsed float64
+	Final   bool
+	timer   Timer
+}
+
+// Wakes the bot up at the check-ins of each poll. Checks are kept by a key
+// for each poll, so the checks of polls which overlap run side by side.
+// Each check is forgotten as it fires, so a poll's checks are gone once its
+// final check has fired.
+type PollScheduler struct {
+	mutex   sync.Mutex
+	clock   Clock
+	pending map[string][]*ScheduledCheck
+}
+
+func newPollScheduler(clock Clock) *PollScheduler {
+	return &PollScheduler{
+		clock:   clock,
+		pending: make(map[string][]*ScheduledCheck),
+	}
+}
+
+// Schedule the check-ins of a poll, replacing any pending checks with the
+// same key, as when a poll is seen again. The poll's times are judged by the
+// clock of the server it's on. Returns false if the poll has already
+// expired.
+func (s *PollScheduler) schedule(key string, serverClock *ServerClock, pollID mastodon.ID, createdAt, expiresAt time.Time, checkIns []CheckIn, check func(ScheduledCheck)) bool {
+	serverNow := serverClock.now()
+	times := checkTimes(createdAt, expiresAt, serverNow, checkIns)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if previous, ok := s.pending[key]; ok {
+		fmt.Println("⏰ Rescheduling the checks of poll", previous[0].PollID)
+		for _, scheduled := range previous {
+			scheduled.timer.Stop()
+		}
+		delete(s.pending, key)
+	}
+
+	if len(times) == 0 {
+		fmt.Println("⏰ Poll", pollID, "has already expired, not scheduling a check")
+		return false
+	}
+
+	for idx, checkTime := range times {
+		delay := checkTime.At.Sub(serverNow)
+		fmt.Printf("⏰ Checking poll %s in %v, %.0f%% of the way through\n", pollID, delay, checkTime.Elapsed*100)
+
+		scheduled := &ScheduledCheck{
+			Key:     key,
+			PollID:  pollID,
+			FireAt:  s.clock.Now().Add(delay),
+			Elapsed: checkTime.Elapsed,
+			Final:   idx == len(times)-1,
+		}
+		scheduled.timer = s.clock.AfterFunc(delay, func() {
+			s.remove(scheduled)
+			fmt.Println("⏰ Timer for poll", pollID, "woke up")
+			check(*scheduled)
+		})
+		s.pending[key] = append(s.pending[key], scheduled)
+	}
+
+	return true
+}
+
+// Forget a check which has fired
+func (s *PollScheduler) remove(scheduled *ScheduledCheck) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	remaining := []*ScheduledCheck{}
+	for _, pending := range s.pending[scheduled.Key] {
+		if pending != scheduled {
+			remaining = append(remaining, pending)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(s.pending, scheduled.Key)
+	} else {
+		s.pending[scheduled.Key] = remaining
+	}
+}
+
+// Cancel the pending checks for a key, if there are any
+func (s *PollScheduler) cancel(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, scheduled := range s.pending[key] {
+		scheduled.timer.Stop()
+	}
+	delete(s.pending, key)
+}
+
+// The checks which haven't fired yet, soonest first
+func (s *PollScheduler) pendingChecks() []ScheduledCheck {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	checks := []ScheduledCheck{}
+	for _, pending := range s.pending {
+		for _, scheduled := range pending {
+			checks = append(checks, *scheduled)
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].FireAt.Before(checks[j].FireAt)
+	})
+	return checks
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A clock which only moves when the test advances it
+type fakeClock struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	c := &fakeClock{now: now}
+	c.changed = sync.NewCond(&c.mutex)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	c.changed.Broadcast()
+	return timer
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	for idx, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:idx], t.clock.timers[idx+1:]...)
+			t.stopped = true
+			return true
+		}
+	}
+	return false
+}
+
+// Move the clock forward, running the timers which come due in order
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	c.now = c.now.Add(d)
+	due := []*fakeTimer{}
+	remaining := []*fakeTimer{}
+	for _, timer := range c.timers {
+		if !timer.at.After(c.now) {
+			due = append(due, timer)
+		} else {
+			remaining = append(remaining, timer)
+		}
+	}
+	c.timers = remaining
+	c.mutex.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+// Wait until this many timers are pending
+func (c *fakeClock) waitForTimers(t *testing.T, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	wake := time.AfterFunc(5*time.Second, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.changed.Broadcast()
+	})
+	defer wake.Stop()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.timers) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d timers", count)
+		}
+		c.changed.Wait()
+	}
+}
+
+var schedulerStart = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestPollSchedulerChecksBeforeExpiry(t *testing.T) {
+	clock := newFakeClock(schedulerStart)
+	serverClock := newServerClock(clock)
+	scheduler := newPollScheduler(clock)
+
+	checked := 0
+	scheduler.schedule("snake_game", serverClock, "1", schedulerStart, schedulerStart.Add(30*time.Minute), defaultCheckIns, func(ScheduledCheck) { checked++ })
+
+	clock.Advance(28*time.Minute - time.Second)
+	if checked != 0 {
+		t.Fatalf("poll was checked %d times before the lead time, want 0", checked)
+	}
+
+	clock.Advance(time.Second)
+	if checked != 1 {
+		t.Errorf("poll was checked %d times at the lead time, want 1", checked)
+	}
+	if len(scheduler.pendingChecks()) != 0 {
+		t.Errorf("scheduler has pending checks %v after firing, want none", scheduler.pendingChecks())
+	}
+}
+
+func TestPollSchedulerSkipsExpiredPoll(t *testing.T) {
+	clock := newFakeClock(schedulerStart)
+	serverClock := newServerClock(clock)
+	scheduler := newPollScheduler(clock)
+
+	result := scheduler.schedule("snake_game", serverClock, "1", schedulerStart.Add(-time.Hour), schedulerStart.Add(-time.Second), defaultCheckIns, func(ScheduledCheck) {})
+	if result {
+		t.Errorf("schedule returned true for an expired poll, want false")
+	}
+	if len(scheduler.pendingChecks()) != 0 {
+		t.Errorf("scheduler has pending checks %v, want none", scheduler.pendingChecks())
+	}
+}
+
+func TestPollSchedulerFollowsOverlappingPolls(t *testing.T) {
+	clock := newFakeClock(schedulerStart)
+	serverClock := newServerClock(clock)
+	scheduler := newPollScheduler(clock)
+
+	checked := []string{}
+	checkIns, _ := parseCheckIns("50%,2m")
+	scheduler.schedule("snake_game 1", serverClock, "1", schedulerStart, schedulerStart.Add(30*time.Minute), checkIns, func(ScheduledCheck) { checked = append(checked, "1") })
+	clock.Advance(10 * time.Minute)
+	scheduler.schedule("snake_game 2", serverClock, "2", schedulerStart.Add(10*time.Minute), schedulerStart.Add(40*time.Minute), checkIns, func(ScheduledCheck) { checked = append(checked, "2") })
+
+	clock.Advance(time.Hour)
+
+	expected := []string{"1", "2", "1", "2"}
+	if strings.Join(checked, ",") != strings.Join(expected, ",") {
+		t.Errorf("checked polls %v, want %v", checked, expected)
+	}
+	if len(scheduler.pendingChecks()) != 0 {
+		t.Errorf("scheduler has pending checks %v after the final checks, want none", scheduler.pendingChecks())
+	}
+}
+
+func TestPollSchedulerReschedulesTheSamePoll(t *testing.T) {
+	clock := newFakeClock(schedulerStart)
+	serverClock := newServerClock(clock)
+	scheduler := newPollScheduler(clock)
+
+	checked := []string{}
+	checkIns, _ := parseCheckIns("50%,2m")
+	scheduler.schedule("snake_game 1", serverClock, "1", schedulerStart, schedulerStart.Add(30*time.Minute), checkIns, func(ScheduledCheck) { checked = append(checked, "old") })
+	scheduler.schedule("snake_game 1", serverClock, "1", schedulerStart, schedulerStart.Add(30*time.Minute), checkIns, func(ScheduledCheck) { checked = append(checked, "new") })
+
+	clock.Advance(time.Hour)
+
+	expected := []string{"new", "new"}
+	if strings.Join(checked, ",") != strings.Join(expected, ",") {
+		t.Errorf("checked %v, want %v", checked, expected)
+	}
+}
+
+func TestPollSchedulerUsesServerTime(t *testing.T) {
+	clock := newFakeClock(schedulerStart)
+	serverClock := newServerClock(clock)
+	scheduler := newPollScheduler(clock)
+
+	// The server's clock is five minutes behind ours
+	serverNow := schedulerStart.Add(-5 * time.Minute)
+	serverClock.observe(serverNow.Add(-time.Second))
+	serverClock.observe(serverNow)
+
+	checked := 0
+	scheduler.schedule("snake_game", serverClock, "1", serverNow, serverNow.Add(30*time.Minute), defaultCheckIns, func(ScheduledCheck) { checked++ })
+
+	clock.Advance(27 * time.Minute)
+	if checked != 0 {
+		t.Fatalf("poll was checked %d times before the lead time, want 0", checked)
+	}
+	clock.Advance(time.Minute)
+	if checked != 1 {
+		t.Errorf("poll was checked %d times at the lead time, want 1", checked)
+	}
+}
+
+func TestPollSchedulerChecksInSeveralTimes(t *testing.T) {
+	clock := newFakeClock(schedulerStart)
+	serverClock := newServerClock(clock)
+	scheduler := newPollScheduler(clock)
+
+	checkIns, _ := parseCheckIns("50%,90%,98%")
+	checks := []ScheduledCheck{}
+	scheduler.schedule("snake_game", serverClock, "1", schedulerStart, schedulerStart.Add(100*time.Minute), checkIns, func(check ScheduledCheck) {
+		checks = append(checks, check)
+	})
+	if len(scheduler.pendingChecks()) != 3 {
+		t.Fatalf("scheduler has %d pending checks, want 3", len(scheduler.pendingChecks()))
+	}
+
+	clock.Advance(time.Hour)
+	if len(checks) != 1 || checks[0].Elapsed != 0.5 || checks[0].Final {
+		t.Fatalf("checks after an hour were %+v, want one non-final check half way through", checks)
+	}
+
+	clock.Advance(time.Hour)
+	if len(checks) != 3 || !checks[2].Final || checks[1].Final {
+		t.Errorf("checks were %+v, want three with only the last one final", checks)
+	}
+	if len(scheduler.pendingChecks()) != 0 {
+		t.Errorf("scheduler has pending checks %v after firing, want none", scheduler.pendingChecks())
+	}
+}
+
+func TestServerClocksAreKeptPerInstance(t *testing.T) {
+	clock := newFakeClock(schedulerStart)
+	serverClocks := newServerClocks(clock)
+
+	// One instance is five minutes behind us, the other on time
+	serverClocks.forAcct("snek@behind.example").observe(schedulerStart.Add(-5 * time.Minute))
+	serverClocks.forAcct("other@ontime.example").observe(schedulerStart)
+
+	if offset := serverClocks.forAcct("snake@Behind.Example").offset(); offset != 5*time.Minute {
+		t.Errorf("offset of behind.example is %v, want 5m", offset)
+	}
+	if offset := serverClocks.forAcct("other@ontime.example").offset(); offset != 0 {
+		t.Errorf("offset of ontime.example is %v, want 0", offset)
+	}
+	if offset := serverClocks.forAcct("snake_game").offset(); offset != 0 {
+		t.Errorf("offset of our own instance is %v, want 0 before any samples", offset)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// The bot talks to the fediverse only through these interfaces. The
+// go-mastodon client implements most of them, and so do the shadow recorder
+// and the fakes used in tests.
+
+// A source of timeline events, such as the user's home stream
+type EventSource interface {
+	Events(ctx context.Context) (chan mastodon.Event, error)
+}
+
+// Posts statuses
+type Publisher interface {
+	PostStatus(ctx context.Context, toot *mastodon.Toot) (*mastodon.Status, error)
+}
+
+// Edits statuses which have already been posted
+type Editor interface {
+	EditStatus(ctx context.Context, id mastodon.ID, toot *mastodon.Toot) (*mastodon.Status, error)
+}
+
+// Reads the statuses around a status in its thread
+type ThreadReader interface {
+	GetStatusContext(ctx context.Context, id mastodon.ID) (*mastodon.Context, error)
+}
+
+// Uploads images to attach to posts
+type MediaUploader interface {
+	UploadMediaFromMedia(ctx context.Context, media *mastodon.Media) (*mastodon.Attachment, error)
+}
+
+// Reads the current state of a poll
+type PollReader interface {
+	GetPoll(ctx context.Context, id mastodon.ID) (*mastodon.Poll, error)
+}
+
+// Votes on polls. Each vote comes with the move it's for as well as the
+// options it picks, so that voters which record votes rather than cast
+// them can say what the vote was for.
+type Voter interface {
+	Vote(ctx context.Context, id mastodon.ID, move string, choices ...int) (*mastodon.Poll, error)
+}
+
+// Looks statuses up, including by their URL
+type StatusSearcher interface {
+	Search(ctx context.Context, q string, resolve bool) (*mastodon.Results, error)
+}
+
+// Reads the instance's limits
+type InstanceReader interface {
+	MaxCharacters(ctx context.Context) (int, error)
+}
+
+// Everything the bot needs from the outside world
+type BotServices struct {
+	Events    EventSource
+	Publisher Publisher
+	Editor    Editor
+	Media     MediaUploader
+	Threads   ThreadReader
+	Polls     PollReader
+	Voter     Voter
+	Instance  InstanceReader
+	Search    StatusSearcher
+	Clock     Clock
+}
+
+// Use a go-mastodon client for everything
+func mastodonServices(client *mastodon.Client) BotServices {
+	return BotServices{
+		Events:    UserStream{Client: client, Clock: realClock{}},
+		Publisher: client,
+		Editor:    StatusEditor{Client: client},
+		Media:     client,
+		Threads:   client,
+		Polls:     client,
+		Voter:     PollVoter{Client: client},
+		Instance:  InstanceLimits{Client: client},
+		Search:    client,
+		Clock:     realClock{},
+	}
+}
+
+// Votes with a go-mastodon client, which only needs the options
+type PollVoter struct {
+	Client *mastodon.Client
+}
+
+func (v PollVoter) Vote(ctx context.Context, id mastodon.ID, move string, choices ...int) (*mastodon.Poll, error) {
+	return v.Client.PollVote(ctx, id, choices...)
+}
+
+// Edits statuses with PUT /api/v1/statuses/:id, which go-mastodon doesn't
+// have yet
+type StatusEditor struct {
+	Client *mastodon.Client
+}
+
+func (e StatusEditor) EditStatus(ctx context.Context, id mastodon.ID, toot *mastodon.Toot) (*mastodon.Status, error) {
+	u, err := url.Parse(e.Client.Config.Server)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "/api/v1/statuses", string(id))
+
+	params := url.Values{}
+	params.Set("status", toot.Status)
+	if toot.SpoilerText != "" {
+		params.Set("spoiler_text", toot.SpoilerText)
+	}
+	if toot.Sensitive {
+		params.Set("sensitive", "true")
+	}
+	for _, mediaID := range toot.MediaIDs {
+		params.Add("media_ids[]", string(mediaID))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if e.Client.Config.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.Client.Config.AccessToken)
+	}
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("editing status %s returned %s", id, resp.Status)
+	}
+
+	var status mastodon.Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Reads the instance's character limit from GET /api/v1/instance.
+// go-mastodon's Instance doesn't have it, and servers report it in different
+// places: Mastodon under configuration, Pleroma and Akkoma as max_toot_chars.
+type InstanceLimits struct {
+	Client *mastodon.Client
+}
+
+func (l InstanceLimits) MaxCharacters(ctx context.Context) (int, error) {
+	u, err := url.Parse(l.Client.Config.Server)
+	if err != nil {
+		return 0, err
+	}
+	u.Path = path.Join(u.Path, "/api/v1/instance")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("reading the instance returned %s", resp.Status)
+	}
+
+	var instance struct {
+		Configuration struct {
+			Statuses struct {
+				MaxCharacters int `json:"max_characters"`
+			} `json:"statuses"`
+		} `json:"configuration"`
+		MaxTootChars int `json:"max_toot_chars"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&instance); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case instance.Configuration.Statuses.MaxCharacters > 0:
+		return instance.Configuration.Statuses.MaxCharacters, nil
+	case instance.MaxTootChars > 0:
+		return instance.MaxTootChars, nil
+	default:
+		return 0, errors.New("the instance doesn't say how long statuses can be")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+type ShadowAction string
+
+const (
+	ShadowPost   ShadowAction = "post"
+	ShadowVote   ShadowAction = "vote"
+	ShadowEdit   ShadowAction = "edit"
+	ShadowUpload ShadowAction = "upload"
+)
+
+// One line of the shadow log: something the bot would have done
+type ShadowRecord struct {
+	Time        time.Time     `json:"time"`
+	Action      ShadowAction  `json:"action"`
+	ID          mastodon.ID   `json:"id,omitempty"`
+	Status      string        `json:"status,omitempty"`
+	InReplyToID mastodon.ID   `json:"in_reply_to_id,omitempty"`
+	Visibility  string        `json:"visibility,omitempty"`
+	SpoilerText string        `json:"spoiler_text,omitempty"`
+	PollID      mastodon.ID   `json:"poll_id,omitempty"`
+	Choices     []int         `json:"choices,omitempty"`
+	Move        string        `json:"move,omitempty"`
+	MediaIDs    []mastodon.ID `json:"media_ids,omitempty"`
+	Description string        `json:"description,omitempty"`
+}
+
+// In shadow mode the bot runs as usual, but instead of posting and voting it
+// writes what it would have done to a JSON lines file. The recorder is a
+// Publisher, an Editor, a MediaUploader and a Voter.
+type ShadowRecorder struct {
+	mutex  sync.Mutex
+	file   *os.File
+	clock  Clock
+	postID int
+}
+
+func openShadowRecorder(filename string, clock Clock) (*ShadowRecorder, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &ShadowRecorder{file: file, clock: clock}, nil
+}
+
+func (r *ShadowRecorder) record(record ShadowRecord) error {
+	record.Time = r.clock.Now()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.file.Write(append(line, '\n'))
+	return err
+}
+
+// Record a status instead of posting it. The returned status has a made up
+// ID so that replies to it can be recorded too.
+func (r *ShadowRecorder) PostStatus(ctx context.Context, toot *mastodon.Toot) (*mastodon.Status, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.postID++
+	id := mastodon.ID(fmt.Sprintf("shadow-%d", r.postID))
+
+	err := r.record(ShadowRecord{
+		Action:      ShadowPost,
+		ID:          id,
+		Status:      toot.Status,
+		InReplyToID: toot.InReplyToID,
+		Visibility:  toot.Visibility,
+		SpoilerText: toot.SpoilerText,
+		MediaIDs:    toot.MediaIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("👻 Recorded post", id, "instead of posting it")
+
+	return &mastodon.Status{ID: id, Content: toot.Status, CreatedAt: r.clock.Now()}, nil
+}
+
+// Record an edit instead of making it
+func (r *ShadowRecorder) EditStatus(ctx context.Context, id mastodon.ID, toot *mastodon.Toot) (*mastodon.Status, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	err := r.record(ShadowRecord{
+		Action:      ShadowEdit,
+		ID:          id,
+		Status:      toot.Status,
+		SpoilerText: toot.SpoilerText,
+		MediaIDs:    toot.MediaIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("👻 Recorded edit of", id, "instead of editing it")
+
+	return &mastodon.Status{ID: id, Content: toot.Status}, nil
+}
+
+// Record an upload instead of making it. Only the alt text is kept, and the
+// returned attachment has a made up ID.
+func (r *ShadowRecorder) UploadMediaFromMedia(ctx context.Context, media *mastodon.Media) (*mastodon.Attachment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.postID++
+	id := mastodon.ID(fmt.Sprintf("shadow-media-%d", r.postID))
+
+	err := r.record(ShadowRecord{
+		Action:      ShadowUpload,
+		ID:          id,
+		Description: media.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("👻 Recorded upload", id, "instead of uploading it")
+
+	return &mastodon.Attachment{ID: id, Type: "image", Description: media.Description}, nil
+}
+
+// Record a vote, and the move it's for, instead of casting it
+func (r *ShadowRecorder) Vote(ctx context.Context, id mastodon.ID, move string, choices ...int) (*mastodon.Poll, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	fmt.Println("👻 Recorded vote for", choices, move, "instead of voting")
+
+	err := r.record(ShadowRecord{
+		Action:  ShadowVote,
+		PollID:  id,
+		Choices: choices,
+		Move:    move,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &mastodon.Poll{ID: id, Voted: true, OwnVotes: choices}, nil
+}
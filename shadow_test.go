@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShadowRecorderRecordsTheMoveVotedFor(t *testing.T) {
+	// setup
+	filename := filepath.Join(t.TempDir(), "shadow.jsonl")
+	clock := newFakeClock(schedulerStart)
+	recorder, err := openShadowRecorder(filename, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// call function to test
+	if _, err := recorder.Vote(context.Background(), "31", "up", 0); err != nil {
+		t.Fatalf("Vote returned error %v", err)
+	}
+
+	// check result
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record ShadowRecord
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &record); err != nil {
+		t.Fatalf("shadow log %q isn't a JSON line: %v", data, err)
+	}
+	if record.Action != ShadowVote || record.PollID != "31" || len(record.Choices) != 1 || record.Choices[0] != 0 || record.Move != "up" {
+		t.Errorf("shadow log has %+v, want a vote on poll 31 for option 0, up", record)
+	}
+	if !record.Time.Equal(schedulerStart) {
+		t.Errorf("shadow log has the vote at %v, want the clock's time %v", record.Time, schedulerStart)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// Play a single move of the game as snakebot would: the snake grows when it
+// eats the food, and new food is placed on a random empty space.
+// Returns the new game state, whether the food was eaten and whether the
+// snake died.
+func simulateStep(game GameState, move string, rng *rand.Rand) (GameState, bool, bool) {
+	newGame := moveInDirection(game, move)
+
+	if collidesWithSomething(newGame) {
+		return newGame, false, true
+	}
+
+	if snakeHead(newGame) != game.Food {
+		debugValidate("simulated move "+move, newGame)
+		return newGame, false, false
+	}
+
+	// The snake ate the food, so it keeps its tail and grows by one
+	newGame.SnakeShape = append(newGame.SnakeShape, snakeTail(game))
+
+	// Place new food somewhere the snake isn't
+	food, ok := randomEmptyPosition(newGame, rng)
+	if ok {
+		newGame.Food = food
+	}
+
+	debugValidate("simulated move "+move, newGame)
+	return newGame, true, false
+}
+
+// Choose a random space on the board which isn't occupied by the snake.
+// Returns false if the snake fills the whole board.
+func randomEmptyPosition(game GameState, rng *rand.Rand) (Position, bool) {
+	occupied := make(map[Position]bool)
+	for _, pos := range game.SnakeShape {
+		occupied[pos] = true
+	}
+
+	free := []Position{}
+	for y := 0; y < game.BoardHeight; y++ {
+		for x := 0; x < game.BoardWidth; x++ {
+			if !occupied[Position{x, y}] {
+				free = append(free, Position{x, y})
+			}
+		}
+	}
+
+	if len(free) == 0 {
+		return Position{}, false
+	}
+
+	return free[rng.Intn(len(free))], true
+}
+
+// Create the starting position of a new game: a short snake in the middle
+// of the board heading right, and food somewhere else.
+func newGameState(boardWidth, boardHeight int, rng *rand.Rand) GameState {
+	y := boardHeight / 2
+	x := boardWidth / 2
+	game := GameState{
+		BoardWidth:  boardWidth,
+		BoardHeight: boardHeight,
+		SnakeShape: []Position{
+			{X: x, Y: y},
+			{X: x - 1, Y: y},
+			{X: x - 2, Y: y},
+		},
+		Direction: "right",
+	}
+	game.Food, _ = randomEmptyPosition(game, rng)
+	return game
+}
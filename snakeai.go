@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
 	"math/rand"
+	"sort"
 )
 
 func calculateManhattanDistance(p1, p2 Position) int {
@@ -161,26 +161,109 @@ func moveSnake(game *GameState) {
 	}
 }
 
-func determineNextMove(game GameState) (string, bool) {
+// Explain in words what goes wrong when the snake makes a deadly move
+func describeDanger(game GameState, move string) string {
+	simulatedGame := moveInDirection(game, move)
+
+	if collidesWithWall(simulatedGame) {
+		return "crash into the wall"
+	} else if collidesWithBody(simulatedGame) {
+		return "bite itself"
+	} else if isTrapped(simulatedGame) {
+		return "get trapped with no way back to its tail"
+	}
+	return ""
+}
+
+// The score the AI gave to a single move
+type MoveEvaluation struct {
+	Move   string `json:"move"`
+	Score  int    `json:"score"`
+	Deadly bool   `json:"deadly"`
+	Danger string `json:"danger,omitempty"`
+}
+
+// Evaluate every possible move, in the fixed order up, down, left, right
+func evaluateMoves(game GameState) []MoveEvaluation {
 	possibleMoves := []string{"up", "down", "left", "right"}
 
+	evaluations := []MoveEvaluation{}
+	for _, move := range possibleMoves {
+		score, isDeadly := evaluateMove(game, move)
+		evaluation := MoveEvaluation{Move: move, Score: score, Deadly: isDeadly}
+		if isDeadly {
+			evaluation.Danger = describeDanger(game, move)
+		}
+		evaluations = append(evaluations, evaluation)
+	}
+
+	return evaluations
+}
+
+// Evaluate every possible move and sort them from best to worst.
+// Moves with equal scores keep the order of evaluateMoves.
+func rankMoves(game GameState) []MoveEvaluation {
+	ranked := evaluateMoves(game)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// Rank the evaluated moves which a poll offers, best first. Options maps
+// each offered move to its poll option.
+func rankOfferedMoves(moves []MoveEvaluation, options map[string]int) []MoveEvaluation {
+	offered := []MoveEvaluation{}
+	for _, evaluation := range moves {
+		if _, ok := options[evaluation.Move]; ok {
+			offered = append(offered, evaluation)
+		}
+	}
+	sort.SliceStable(offered, func(i, j int) bool {
+		return offered[i].Score > offered[j].Score
+	})
+	return offered
+}
+
+// How many moves ahead the planned path in the analysis image goes
+const plannedPathLength = 5
+
+// The squares the snake's head would visit over the next few moves if it
+// made the given move and then kept taking the AI's best move. The plan
+// stops early at the food, or before a deadly move.
+func plannedPath(game GameState, move string, steps int) []Position {
+	path := []Position{}
+	for step := 0; step < steps; step++ {
+		if step > 0 {
+			move = rankMoves(game)[0].Move
+		}
+		next := moveInDirection(game, move)
+		if collidesWithSomething(next) {
+			break
+		}
+		path = append(path, snakeHead(next))
+		if snakeHead(next) == game.Food {
+			break
+		}
+		game = next
+	}
+	return path
+}
+
+func determineNextMove(game GameState) (string, bool) {
 	// Evaluate each possible move and choose the best one
 	bestMove := ""
 	bestScore := -1
 	mustTurn := false
 
-	for _, move := range possibleMoves {
-		score, isDeadly := evaluateMove(game, move)
-
-		fmt.Println("Move:", move, "Score:", score)
-
-		if score > bestScore {
-			bestScore = score
-			bestMove = move
+	for _, evaluation := range evaluateMoves(game) {
+		if evaluation.Score > bestScore {
+			bestScore = evaluation.Score
+			bestMove = evaluation.Move
 		}
 
-		if isDeadly {
-			if move == game.Direction {
+		if evaluation.Deadly {
+			if evaluation.Move == game.Direction {
 				mustTurn = true
 			}
 		}
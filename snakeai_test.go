@@ -410,3 +410,89 @@ func TestMoveInDirection(t *testing.T) {
 		t.Errorf("simulateMove returned %v, want %v", result, expected)
 	}
 }
+
+func TestRankMoves(t *testing.T) {
+	// setup game state
+	game := GameState{
+		BoardWidth:  3,
+		BoardHeight: 3,
+		SnakeShape: []Position{
+			{X: 0, Y: 1}, // Head
+			{X: 1, Y: 1}, // Middle
+			{X: 2, Y: 1}, // Tail
+		},
+		Food:      Position{X: 0, Y: 0},
+		Direction: "left",
+	}
+
+	// call function to test
+	result := rankMoves(game)
+
+	// check result
+	expected := []string{"up", "down", "left", "right"}
+	for idx, move := range expected {
+		if result[idx].Move != move {
+			t.Fatalf("rankMoves returned %v, want moves in order %v", result, expected)
+		}
+	}
+	if result[1].Deadly || !result[2].Deadly {
+		t.Errorf("rankMoves returned %v, want only the last two moves to be deadly", result)
+	}
+}
+
+func TestRankOfferedMoves(t *testing.T) {
+	// setup game state
+	moves := []MoveEvaluation{
+		{Move: "up", Score: 38},
+		{Move: "down", Score: 34},
+		{Move: "left", Score: -45, Deadly: true},
+		{Move: "right", Score: -45, Deadly: true},
+	}
+	options := map[string]int{"right": 0, "down": 1, "left": 2}
+
+	// call function to test
+	result := rankOfferedMoves(moves, options)
+
+	// check result
+	expected := []string{"down", "left", "right"}
+	if len(result) != len(expected) {
+		t.Fatalf("rankOfferedMoves returned %v, want moves %v", result, expected)
+	}
+	for idx, move := range expected {
+		if result[idx].Move != move {
+			t.Errorf("rankOfferedMoves returned %v, want moves in order %v", result, expected)
+		}
+	}
+}
+
+func TestPlannedPath(t *testing.T) {
+	// setup game state: heading right along the middle row, food ahead
+	game := GameState{
+		BoardWidth:  8,
+		BoardHeight: 5,
+		SnakeShape: []Position{
+			{X: 2, Y: 2}, // Head
+			{X: 1, Y: 2},
+			{X: 0, Y: 2},
+		},
+		Food:      Position{X: 5, Y: 2},
+		Direction: "right",
+	}
+
+	// call function to test
+	result := plannedPath(game, "right", plannedPathLength)
+
+	// check result: the plan stops at the food
+	expected := []Position{{X: 3, Y: 2}, {X: 4, Y: 2}, {X: 5, Y: 2}}
+	if !equalPositions(result, expected) {
+		t.Errorf("plannedPath returned %v, want %v", result, expected)
+	}
+
+	// call function to test with a deadly first move
+	result = plannedPath(game, "left", plannedPathLength)
+
+	// check result
+	if len(result) != 0 {
+		t.Errorf("plannedPath returned %v, want no path", result)
+	}
+}
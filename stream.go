@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// A status which has been edited. go-mastodon has no event for this, so the
+// bot reads the stream itself; embedding the update event makes it a
+// mastodon.Event.
+type StatusEditEvent struct {
+	*mastodon.UpdateEvent
+}
+
+// The longest wait between attempts to reconnect to the stream
+const maxStreamBackoff = time.Minute
+
+// The user's home stream, read directly rather than with go-mastodon, whose
+// reader drops status.update events. Reconnects with a growing delay when
+// the connection drops, timed by the clock (the real one if there's none).
+type UserStream struct {
+	Client *mastodon.Client
+	Clock  Clock
+}
+
+func (s UserStream) Events(ctx context.Context) (chan mastodon.Event, error) {
+	u, err := url.Parse(s.Client.Config.Server)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "/api/v1/streaming/user")
+
+	clock := s.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	q := make(chan mastodon.Event)
+	go func() {
+		defer close(q)
+		backoff := time.Second
+		for {
+			connected, err := s.read(ctx, u.String(), q)
+			if ctx.Err() != nil {
+				return
+			}
+			if connected {
+				backoff = time.Second
+			}
+			fmt.Println("Stream disconnected:", err, "- reconnecting in", backoff)
+
+			wake := make(chan struct{})
+			timer := clock.AfterFunc(backoff, func() { close(wake) })
+			select {
+			case <-wake:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+			backoff *= 2
+			if backoff > maxStreamBackoff {
+				backoff = maxStreamBackoff
+			}
+		}
+	}()
+	return q, nil
+}
+
+// Read the stream until the connection drops. Returns whether it connected.
+func (s UserStream) read(ctx context.Context, streamURL string, q chan mastodon.Event) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if s.Client.Config.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Client.Config.AccessToken)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("stream returned %s", resp.Status)
+	}
+
+	// Server-sent events: "event:" and "data:" lines, ended by a blank line.
+	// Lines starting with a colon are heartbeats.
+	name := ""
+	data := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch {
+		case line == "":
+			if name != "" && len(data) > 0 {
+				if event := parseStreamEvent(name, strings.Join(data, "\n")); event != nil {
+					select {
+					case q <- event:
+					case <-ctx.Done():
+						return true, ctx.Err()
+					}
+				}
+			}
+			name = ""
+			data = data[:0]
+		case field == "event":
+			name = value
+		case field == "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, fmt.Errorf("stream closed")
+}
+
+// Turn a stream event into a mastodon.Event. Events the bot doesn't use,
+// and ones which can't be read, are logged and dropped.
+func parseStreamEvent(name, data string) mastodon.Event {
+	switch name {
+	case "update", "status.update":
+		var status mastodon.Status
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			fmt.Println("Failed to read", name, "event:", err)
+			return nil
+		}
+		if name == "status.update" {
+			return &StatusEditEvent{&mastodon.UpdateEvent{Status: &status}}
+		}
+		return &mastodon.UpdateEvent{Status: &status}
+	case "notification":
+		var notification mastodon.Notification
+		if err := json.Unmarshal([]byte(data), &notification); err != nil {
+			fmt.Println("Failed to read notification event:", err)
+			return nil
+		}
+		return &mastodon.NotificationEvent{Notification: &notification}
+	case "delete":
+		return &mastodon.DeleteEvent{ID: mastodon.ID(strings.TrimSpace(data))}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestParseStreamEvent(t *testing.T) {
+	// setup
+	status := `{"id":"42","content":"<p>The snake moves on</p>"}`
+
+	// call function to test
+	update := parseStreamEvent("update", status)
+	edit := parseStreamEvent("status.update", status)
+	deleted := parseStreamEvent("delete", "42")
+	malformed := parseStreamEvent("update", "{not json")
+	unknown := parseStreamEvent("filters_changed", "")
+
+	// check result
+	if event, ok := update.(*mastodon.UpdateEvent); !ok || event.Status.ID != "42" {
+		t.Errorf("parseStreamEvent(update) returned %#v, want an update of status 42", update)
+	}
+	if event, ok := edit.(*StatusEditEvent); !ok || event.Status.ID != "42" {
+		t.Errorf("parseStreamEvent(status.update) returned %#v, want an edit of status 42", edit)
+	}
+	if event, ok := deleted.(*mastodon.DeleteEvent); !ok || event.ID != "42" {
+		t.Errorf("parseStreamEvent(delete) returned %#v, want a delete of status 42", deleted)
+	}
+	if malformed != nil {
+		t.Errorf("parseStreamEvent(malformed) returned %#v, want nil", malformed)
+	}
+	if unknown != nil {
+		t.Errorf("parseStreamEvent(filters_changed) returned %#v, want nil", unknown)
+	}
+}
+
+// How long until the clock's next timer fires
+func (c *fakeClock) nextTimer() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.timers[0].at.Sub(c.now)
+}
+
+func TestUserStreamReconnectsWithBackoff(t *testing.T) {
+	// setup: a server which turns the first two connections down
+	fake := newFakeMastodon(t)
+	fake.rejectStreams = 2
+	clock := newFakeClock(schedulerStart)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// call function to test
+	events, err := UserStream{Client: fake.client(), Clock: clock}.Events(ctx)
+	if err != nil {
+		t.Fatalf("Events returned error %v", err)
+	}
+
+	// check result: the wait doubles after each failure
+	for attempt, backoff := range []time.Duration{time.Second, 2 * time.Second} {
+		clock.waitForTimers(t, 1)
+		if next := clock.nextTimer(); next != backoff {
+			t.Fatalf("reconnecting after attempt %d in %v, want %v", attempt+1, next, backoff)
+		}
+		clock.Advance(backoff)
+	}
+	fake.waitForStream()
+
+	board := fake.snakebotBoard(safeGame)
+	fake.emit(board)
+	select {
+	case event := <-events:
+		if update, ok := event.(*mastodon.UpdateEvent); !ok || update.Status.ID != board.ID {
+			t.Errorf("stream delivered %#v, want the board", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stream didn't deliver the board after reconnecting")
+	}
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if fake.streamAttempts != 3 {
+		t.Errorf("stream connected %d times, want 3", fake.streamAttempts)
+	}
+}
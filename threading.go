@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Where the bot's analyses go in the conversation
+const (
+	// A standalone post which links to the board
+	ThreadLink = "link"
+	// A reply to the board
+	ThreadReply = "reply"
+	// A reply to the analysis of the game's previous board, so each game
+	// is one thread of the bot's own
+	ThreadGame = "game"
+)
+
+// Who can see the bot's posts
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+)
+
+// How the bot's posts appear to its followers
+type PostingConfig struct {
+	// One of the Thread modes. The default is ThreadLink.
+	Threading string
+
+	// One of the Visibility values. The default is the account's own
+	// default visibility.
+	Visibility string
+
+	// A content warning to put on every post, if any
+	ContentWarning string
+
+	// Whether to attach an image of the analysis to each analysis post
+	AnalysisImage bool
+
+	// How the board is drawn in posts, the log and alt text
+	Boards BoardStyles
+}
+
+func (p PostingConfig) validate() error {
+	switch p.Threading {
+	case "", ThreadLink, ThreadReply, ThreadGame:
+	default:
+		return fmt.Errorf("unsupported threading mode %q, expected %s, %s or %s", p.Threading, ThreadLink, ThreadReply, ThreadGame)
+	}
+	switch p.Visibility {
+	case "", VisibilityPublic, VisibilityUnlisted:
+	default:
+		return fmt.Errorf("unsupported visibility %q, expected %s or %s", p.Visibility, VisibilityPublic, VisibilityUnlisted)
+	}
+	return nil
+}
+
+// A post with the bot's visibility and content warning
+func (p PostingConfig) toot(status string, inReplyToID mastodon.ID) *mastodon.Toot {
+	return &mastodon.Toot{
+		Status:      status,
+		InReplyToID: inReplyToID,
+		Visibility:  p.Visibility,
+		SpoilerText: strings.TrimSpace(p.ContentWarning),
+	}
+}
+
+// The last analysis posted in each account's current game
+type gameThread struct {
+	postID mastodon.ID
+	game   GameState
+}
+
+// Keeps track of each account's game thread. A board carries on the last
+// game if it's the same size, the snake is no shorter, and the snake's body
+// covers the square the head was on last time; anything else is a new game,
+// and starts a new thread.
+type GameThreads struct {
+	threads map[string]gameThread
+}
+
+func newGameThreads() *GameThreads {
+	return &GameThreads{threads: make(map[string]gameThread)}
+}
+
+// The post an analysis of this board should reply to, if any
+func (g *GameThreads) replyTo(acct string, game GameState) mastodon.ID {
+	thread, ok := g.threads[acct]
+	if !ok || !continuesGame(thread.game, game) {
+		return ""
+	}
+	return thread.postID
+}
+
+// Remember the latest analysis in an account's game
+func (g *GameThreads) posted(acct string, game GameState, postID mastodon.ID) {
+	g.threads[acct] = gameThread{postID: postID, game: game}
+}
+
+// Whether a board is a later move of the same game as an earlier one. Snakes
+// only ever grow, and move a square a turn, so unless boards have been
+// missed the head's last square is still under the snake. A new game starts
+// a new snake somewhere else, whatever its length.
+func continuesGame(previous, next GameState) bool {
+	if previous.BoardWidth != next.BoardWidth || previous.BoardHeight != next.BoardHeight {
+		return false
+	}
+	if len(previous.SnakeShape) == 0 || len(next.SnakeShape) < len(previous.SnakeShape) {
+		return false
+	}
+	for _, pos := range next.SnakeShape {
+		if pos == previous.SnakeShape[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// The status an analysis of a board should reply to under a threading mode
+func analysisReplyTo(posting PostingConfig, threads *GameThreads, account *WatchedAccount, board *mastodon.Status, game GameState) mastodon.ID {
+	switch posting.Threading {
+	case ThreadReply:
+		return board.ID
+	case ThreadGame:
+		return threads.replyTo(account.Acct, game)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestContinuesGame(t *testing.T) {
+	// setup: the safe game a move later, and games which can't follow it
+	nextMove := mustParseBoardDrawing(`
+		........
+		........
+		..o->.@.
+		........
+		........`)
+	diedEarly := mustParseBoardDrawing(`
+		........
+		.@......
+		........
+		........
+		...<-o..`)
+	wider := mustParseBoardDrawing(`
+		.........
+		.........
+		.o->..@..
+		.........
+		.........`)
+	tests := []struct {
+		name string
+		next GameState
+		want bool
+	}{
+		{"the same board", safeGame, true},
+		{"the next move", nextMove, true},
+		{"a new snake as long as the old one", diedEarly, false},
+		{"a different board size", wider, false},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		result := continuesGame(safeGame, test.next)
+
+		// check result
+		if result != test.want {
+			t.Errorf("continuesGame with %s returned %v, want %v", test.name, result, test.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// The status a status replies to. go-mastodon leaves InReplyToID as an
+// interface{}, which holds whatever the JSON did: usually a string, but a
+// number from some servers, and nil for a status which isn't a reply.
+func replyParent(status *mastodon.Status) (mastodon.ID, bool) {
+	switch id := status.InReplyToID.(type) {
+	case string:
+		return mastodon.ID(id), id != ""
+	case mastodon.ID:
+		return id, id != ""
+	case float64:
+		if id <= 0 || id != float64(int64(id)) {
+			return "", false
+		}
+		return mastodon.ID(strconv.FormatInt(int64(id), 10)), true
+	case int64:
+		return mastodon.ID(strconv.FormatInt(id, 10)), id > 0
+	default:
+		return "", false
+	}
+}
+
+// Whether a status looks like a board: an image and no poll
+func isBoardStatus(status *mastodon.Status) bool {
+	return status.Poll == nil && len(status.MediaAttachments) > 0 && status.MediaAttachments[0].Type == "image"
+}
+
+// Find the board a poll is about. Snakebot replies to the board with the
+// poll, so a reply to a board we know is taken at its word. Otherwise the
+// poll's thread is searched for the nearest board above it from the same
+// account, which copes with polls that aren't replies, or that reply to
+// something other than the board. If the thread can't be read, the poll's
+// parent is the best guess left.
+func findPollBoard(ctx context.Context, threads ThreadReader, poll *mastodon.Status, knownBoard func(mastodon.ID) bool) (mastodon.ID, error) {
+	parent, isReply := replyParent(poll)
+	if isReply && knownBoard(parent) {
+		return parent, nil
+	}
+
+	if threads == nil {
+		if isReply {
+			return parent, nil
+		}
+		return "", errors.New("the poll isn't a reply")
+	}
+
+	thread, err := threads.GetStatusContext(ctx, poll.ID)
+	if err != nil {
+		if isReply {
+			fmt.Println("Failed to read the poll's thread, so assuming it's about the status it replies to:", err)
+			return parent, nil
+		}
+		return "", fmt.Errorf("the poll isn't a reply and its thread can't be read: %v", err)
+	}
+
+	// Ancestors come oldest first, so the nearest board is the last one
+	for idx := len(thread.Ancestors) - 1; idx >= 0; idx-- {
+		ancestor := thread.Ancestors[idx]
+		if ancestor.Account.ID == poll.Account.ID && isBoardStatus(ancestor) {
+			return ancestor.ID, nil
+		}
+	}
+	return "", errors.New("no board above the poll in its thread")
+}
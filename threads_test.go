@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattn/go-mastodon"
+)
+
+func TestReplyParent(t *testing.T) {
+	// setup
+	tests := []struct {
+		inReplyToID interface{}
+		want        mastodon.ID
+		wantOk      bool
+	}{
+		{"109", "109", true},
+		{mastodon.ID("109"), "109", true},
+		{float64(109), "109", true},
+		{int64(109), "109", true},
+		{nil, "", false},
+		{"", "", false},
+		{float64(1.5), "", false},
+		{true, "", false},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got, ok := replyParent(&mastodon.Status{InReplyToID: test.inReplyToID})
+
+		// check result
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("replyParent(%#v) returned %q, %v, want %q, %v", test.inReplyToID, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+// A thread reader which serves one thread, or fails
+type fakeThreads struct {
+	ancestors []*mastodon.Status
+	err       error
+	calls     int
+}
+
+func (f *fakeThreads) GetStatusContext(ctx context.Context, id mastodon.ID) (*mastodon.Context, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &mastodon.Context{Ancestors: f.ancestors}, nil
+}
+
+func TestFindPollBoard(t *testing.T) {
+	// setup
+	snakebot := mastodon.Account{ID: "1", Acct: "snake_game"}
+	someoneElse := mastodon.Account{ID: "7", Acct: "someone"}
+	image := []mastodon.Attachment{{Type: "image"}}
+	board := &mastodon.Status{ID: "10", Account: snakebot, MediaAttachments: image}
+	note := &mastodon.Status{ID: "11", Account: snakebot, InReplyToID: "10"}
+	otherImage := &mastodon.Status{ID: "12", Account: someoneElse, InReplyToID: "11", MediaAttachments: image}
+	thread := []*mastodon.Status{board, note, otherImage}
+	knownBoards := func(id mastodon.ID) bool { return id == "10" }
+	noBoards := func(id mastodon.ID) bool { return false }
+
+	tests := []struct {
+		name      string
+		poll      *mastodon.Status
+		threads   *fakeThreads
+		known     func(mastodon.ID) bool
+		want      mastodon.ID
+		wantErr   bool
+		wantCalls int
+	}{
+		{"reply to a known board", &mastodon.Status{ID: "20", Account: snakebot, InReplyToID: "10"}, &fakeThreads{ancestors: thread}, knownBoards, "10", false, 0},
+		{"reply to something else", &mastodon.Status{ID: "20", Account: snakebot, InReplyToID: "12"}, &fakeThreads{ancestors: thread}, knownBoards, "10", false, 1},
+		{"board not seen yet", &mastodon.Status{ID: "20", Account: snakebot, InReplyToID: "10"}, &fakeThreads{ancestors: thread}, noBoards, "10", false, 1},
+		{"not a reply", &mastodon.Status{ID: "20", Account: snakebot}, &fakeThreads{}, knownBoards, "", true, 1},
+		{"thread can't be read", &mastodon.Status{ID: "20", Account: snakebot, InReplyToID: "11"}, &fakeThreads{err: errors.New("gone")}, knownBoards, "11", false, 1},
+		{"no board in the thread", &mastodon.Status{ID: "20", Account: snakebot, InReplyToID: "11"}, &fakeThreads{ancestors: []*mastodon.Status{note}}, knownBoards, "", true, 1},
+	}
+
+	for _, test := range tests {
+		// call function to test
+		got, err := findPollBoard(context.Background(), test.threads, test.poll, test.known)
+
+		// check result
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("%s: findPollBoard returned %q, %v, want %q", test.name, got, err, test.want)
+		}
+		if test.threads.calls != test.wantCalls {
+			t.Errorf("%s: findPollBoard read the thread %d times, want %d", test.name, test.threads.calls, test.wantCalls)
+		}
+	}
+}